@@ -1,36 +1,116 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 
+	"fuwapachi/internal/apierror"
 	"fuwapachi/internal/config"
 	"fuwapachi/internal/database"
 	"fuwapachi/internal/handler"
+	"fuwapachi/internal/logging"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/tracing"
 )
 
 func main() {
 	// .envファイルを読み込み
 	if err := godotenv.Load(); err != nil {
-		log.Printf("⚠️  .env file not found, using default values: %v", err)
+		slog.Warn(".env file not found, using default values", "error", err)
 	}
 
 	// 環境変数を読み込み
 	cfg := config.Load()
 
+	// 本番環境では JSON、開発環境ではテキストで構造化ログを出力する
+	slog.SetDefault(logging.New(cfg.Env, os.Stderr))
+
+	// run の defer（トレースの送信やデータベースの切断）が済んでから終了する
+	if err := run(cfg); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and blocks until it stops. SIGINT / SIGTERM で
+// サーバーを停止し、エラーの場合も含めて後始末をしてから戻る
+func run(cfg config.Config) error {
+	// エラーメッセージの既定の言語（Accept-Language で一致しない場合に使う）
+	if err := apierror.SetFallbackLanguage(cfg.ErrorLanguage); err != nil {
+		return fmt.Errorf("invalid ERROR_LANGUAGE: %w", err)
+	}
+
+	// 署名鍵がプロセスごとに異なると、再起動や他のインスタンスでチャレンジを検証できない
+	if cfg.PowEnabled && cfg.PowSecret == "" {
+		return errors.New("POW_SECRET is required when POW_ENABLED=true")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// OpenTelemetry のトレーシング（TRACING_EXPORTER=otlp / stdout）
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+
 	// データベース接続を初期化
 	db, err := database.Init(cfg)
 	if err != nil {
-		log.Fatalf("❌ Failed to initialize database: %v", err)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
+	// スキーマを最新化
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// FULLTEXT 検索は ngram パーサのインデックスがある場合のみ使う
+	cfg.SearchBackend, err = database.ResolveSearchBackend(db, cfg.SearchBackend)
+	if err != nil {
+		return fmt.Errorf("failed to check search backend: %w", err)
+	}
+
 	// ハンドラー初期化
 	h := handler.New(db, cfg)
+	defer h.Backplane.Close()
+	defer h.NGWords.Close()
+
+	// NGワードリストの変更を監視
+	go h.NGWords.Watch(cfg.NGWordReloadInterval)
+
+	// IP/CIDR の禁止リストを読み込み、他のインスタンスでの変更を定期的に反映
+	if err := h.Bans.Refresh(ctx); err != nil {
+		return fmt.Errorf("failed to load ban list: %w", err)
+	}
+	defer h.Bans.Close()
+	go h.Bans.Watch(cfg.BanRefreshInterval)
+
+	// シャドウバンの一覧も同じ間隔で再読み込みする
+	if err := h.ShadowBans.Refresh(ctx); err != nil {
+		return fmt.Errorf("failed to load shadow ban list: %w", err)
+	}
+	defer h.ShadowBans.Close()
+	go h.ShadowBans.Watch(cfg.BanRefreshInterval)
+
+	// 期限切れの Idempotency-Key と使用済みチャレンジを定期的に削除
+	go h.PurgeExpired()
 
 	// WebSocket ブロードキャスターを開始
 	go h.HandleBroadcast()
@@ -41,25 +121,56 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   cfg.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS", "PUT"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		ExposedHeaders:   []string{"Content-Length"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key", "X-PoW-Solution", "X-Captcha-Token", middleware.ClientTokenHeader, middleware.RequestIDHeader},
+		ExposedHeaders:   []string{"Content-Length", "X-Seen-Token", "Idempotent-Replayed", middleware.RequestIDHeader},
 		MaxAge:           300,
 		AllowCredentials: true,
 	})
 
-	httpHandler := c.Handler(router)
+	// リクエストIDはCORSの外側に置き、CORSのプリフライトや404を含むすべてのリクエストに付与する。
+	// ハンドラーの panic は 500 のJSONレスポンスにしてリクエストIDとともにログに残す
+	servers := []*http.Server{{Addr: ":" + cfg.ServerPort, Handler: middleware.RequestID(c.Handler(middleware.Recover(router)))}}
+
+	// メトリクスは内部ネットワークからのみ到達できるアドレスで別に公開する
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", h.Metrics.Handler())
+		servers = append(servers, &http.Server{Addr: cfg.MetricsAddr, Handler: metricsMux})
+	}
 
-	fmt.Println("========================================")
-	fmt.Println("  Fuwapachi API Server")
-	fmt.Println("========================================")
-	fmt.Printf("  Environment: %s\n", cfg.Env)
-	fmt.Printf("  Server: http://localhost:%s\n", cfg.ServerPort)
-	fmt.Printf("  WebSocket: ws://localhost:%s/ws\n", cfg.ServerPort)
+	attrs := []any{
+		"env", cfg.Env,
+		"addr", ":" + cfg.ServerPort,
+		"allowed_origins", cfg.AllowedOrigins,
+		"broadcast_backend", cfg.BroadcastBackend,
+	}
+	if cfg.MetricsAddr != "" {
+		attrs = append(attrs, "metrics_addr", cfg.MetricsAddr)
+	}
 	if cfg.DBName != "" {
-		fmt.Printf("  Database: %s@%s:%s/%s\n", cfg.DBUser, cfg.DBHost, cfg.DBPort, cfg.DBName)
+		attrs = append(attrs, "database", cfg.DBUser+"@"+cfg.DBHost+":"+cfg.DBPort+"/"+cfg.DBName)
+	}
+	slog.Info("server started", attrs...)
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+	}
+
+	// シグナルを受けるか、いずれかのリスナーが止まったらすべて停止する
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+		err = nil
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		srv.Shutdown(shutdownCtx)
 	}
-	fmt.Printf("  Allowed Origins: %v\n", cfg.AllowedOrigins)
-	fmt.Println("========================================")
-	log.Println("🚀 Server started successfully")
-	log.Fatal(http.ListenAndServe(":"+cfg.ServerPort, httpHandler))
+	return err
 }
@@ -0,0 +1,211 @@
+// Package apierror defines the error responses of the API.
+//
+// Every error has a stable machine-readable code, from which the HTTP status
+// and the human-readable message are derived, and optional details. The
+// message is localized from the catalogs in messages/ (see Negotiate):
+//
+//	{"code": "content_too_long", "message": "content must be 200 characters or less", "details": {"max": 200}}
+//
+// Clients should branch on code; message is meant for people and may change.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Code identifies the kind of an error. 値は API の一部なので変更しないこと
+type Code string
+
+// Codes returned by the API
+const (
+	// リクエスト全般
+	InvalidBody      Code = "invalid_body"
+	InternalError    Code = "internal_error"
+	DatabaseError    Code = "database_error"
+	RateLimited      Code = "rate_limited"
+	ForbiddenOrigin  Code = "forbidden_origin"
+	IPBanned         Code = "ip_banned"
+	Unauthorized     Code = "unauthorized"
+	AdminDisabled    Code = "admin_disabled"
+	NotFound         Code = "not_found"
+	MethodNotAllowed Code = "method_not_allowed"
+	InvalidHandshake Code = "invalid_websocket_handshake"
+
+	// メッセージ
+	ContentRequired   Code = "content_required"
+	ContentTooLong    Code = "content_too_long"
+	ProhibitedContent Code = "prohibited_content"
+	DuplicateContent  Code = "duplicate_content"
+	ParentNotFound    Code = "parent_not_found"
+	MessageNotFound   Code = "message_not_found"
+	MessageDeleted    Code = "message_deleted"
+	UnknownReaction   Code = "unknown_reaction"
+	UnknownReason     Code = "unknown_report_reason"
+
+	// クエリパラメーター
+	InvalidCount     Code = "invalid_count"
+	InvalidLimit     Code = "invalid_limit"
+	InvalidCursor    Code = "invalid_cursor"
+	InvalidOrder     Code = "invalid_order"
+	InvalidTimestamp Code = "invalid_timestamp"
+	InvalidExclusion Code = "invalid_exclusion"
+	InvalidQuery     Code = "invalid_query"
+	InvalidStatus    Code = "invalid_status"
+
+	// Idempotency-Key
+	IdempotencyKeyTooLong  Code = "idempotency_key_too_long"
+	IdempotencyKeyMismatch Code = "idempotency_key_mismatch"
+	IdempotencyInProgress  Code = "idempotency_in_progress"
+	IdempotencyKeyReleased Code = "idempotency_key_released"
+
+	// プルーフ・オブ・ワーク / CAPTCHA
+	PowDisabled        Code = "pow_disabled"
+	PowRequired        Code = "pow_required"
+	PowInvalid         Code = "pow_invalid"
+	PowExpired         Code = "pow_expired"
+	CaptchaRequired    Code = "captcha_required"
+	CaptchaFailed      Code = "captcha_failed"
+	CaptchaUnavailable Code = "captcha_unavailable"
+
+	// 管理API
+	ReasonTooLong     Code = "reason_too_long"
+	MessageNotPending Code = "message_not_pending"
+	MessageNotRemoved Code = "message_not_removed"
+	InvalidCIDR       Code = "invalid_cidr"
+	InvalidDuration   Code = "invalid_duration"
+	ConflictingExpiry Code = "conflicting_expiry"
+	ExpiryInPast      Code = "expiry_in_past"
+	BanNotFound       Code = "ban_not_found"
+	InvalidActor      Code = "invalid_actor"
+	ShadowBanNotFound Code = "shadow_ban_not_found"
+)
+
+// statuses maps each code to its HTTP status. メッセージは messages/*.json のカタログにある
+var statuses = map[Code]int{
+	InvalidBody:      http.StatusBadRequest,
+	InternalError:    http.StatusInternalServerError,
+	DatabaseError:    http.StatusInternalServerError,
+	RateLimited:      http.StatusTooManyRequests,
+	ForbiddenOrigin:  http.StatusForbidden,
+	IPBanned:         http.StatusForbidden,
+	Unauthorized:     http.StatusUnauthorized,
+	AdminDisabled:    http.StatusForbidden,
+	NotFound:         http.StatusNotFound,
+	MethodNotAllowed: http.StatusMethodNotAllowed,
+	InvalidHandshake: http.StatusBadRequest,
+
+	ContentRequired:   http.StatusBadRequest,
+	ContentTooLong:    http.StatusBadRequest,
+	ProhibitedContent: http.StatusBadRequest,
+	DuplicateContent:  http.StatusTooManyRequests,
+	ParentNotFound:    http.StatusBadRequest,
+	MessageNotFound:   http.StatusNotFound,
+	MessageDeleted:    http.StatusGone,
+	UnknownReaction:   http.StatusBadRequest,
+	UnknownReason:     http.StatusBadRequest,
+
+	InvalidCount:     http.StatusBadRequest,
+	InvalidLimit:     http.StatusBadRequest,
+	InvalidCursor:    http.StatusBadRequest,
+	InvalidOrder:     http.StatusBadRequest,
+	InvalidTimestamp: http.StatusBadRequest,
+	InvalidExclusion: http.StatusBadRequest,
+	InvalidQuery:     http.StatusBadRequest,
+	InvalidStatus:    http.StatusBadRequest,
+
+	IdempotencyKeyTooLong:  http.StatusBadRequest,
+	IdempotencyKeyMismatch: http.StatusUnprocessableEntity,
+	IdempotencyInProgress:  http.StatusConflict,
+	IdempotencyKeyReleased: http.StatusConflict,
+
+	PowDisabled:        http.StatusNotFound,
+	PowRequired:        http.StatusPreconditionRequired,
+	PowInvalid:         http.StatusForbidden,
+	PowExpired:         http.StatusForbidden,
+	CaptchaRequired:    http.StatusBadRequest,
+	CaptchaFailed:      http.StatusForbidden,
+	CaptchaUnavailable: http.StatusServiceUnavailable,
+
+	ReasonTooLong:     http.StatusBadRequest,
+	MessageNotPending: http.StatusConflict,
+	MessageNotRemoved: http.StatusConflict,
+	InvalidCIDR:       http.StatusBadRequest,
+	InvalidDuration:   http.StatusBadRequest,
+	ConflictingExpiry: http.StatusBadRequest,
+	ExpiryInPast:      http.StatusBadRequest,
+	BanNotFound:       http.StatusNotFound,
+	InvalidActor:      http.StatusBadRequest,
+	ShadowBanNotFound: http.StatusNotFound,
+}
+
+// Error is an error response of the API
+type Error struct {
+	Code    Code
+	Details map[string]any
+}
+
+// New creates an Error with details given as alternating keys and values,
+// e.g. New(ContentTooLong, "max", 200)
+func New(code Code, details ...any) *Error {
+	e := &Error{Code: code}
+	for i := 0; i+1 < len(details); i += 2 {
+		key, ok := details[i].(string)
+		if !ok {
+			continue
+		}
+		if e.Details == nil {
+			e.Details = make(map[string]any)
+		}
+		e.Details[key] = details[i+1]
+	}
+	return e
+}
+
+// Error implements the error interface. メッセージは常に英語
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message(language.English)
+}
+
+// Status returns the HTTP status of e (500 for an unknown code)
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Message returns the human-readable message of e in lang (a language
+// returned by Negotiate) with its details filled in
+func (e *Error) Message(lang language.Tag) string {
+	message := lookup(lang, e.Code)
+	for key, value := range e.Details {
+		message = strings.ReplaceAll(message, "{"+key+"}", fmt.Sprint(value))
+	}
+	return message
+}
+
+// Body is the JSON representation of an Error
+type Body struct {
+	Code    Code           `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+	// Error は message と同じ値。code 導入前のクライアントとの互換性のために残している
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Body returns the JSON representation of e in lang for the request requestID
+func (e *Error) Body(requestID string, lang language.Tag) Body {
+	message := e.Message(lang)
+	return Body{
+		Code:      e.Code,
+		Message:   message,
+		Details:   e.Details,
+		Error:     message,
+		RequestID: requestID,
+	}
+}
@@ -0,0 +1,91 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestError_Body(t *testing.T) {
+	e := New(ContentTooLong, "max", 200)
+	if e.Status() != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, e.Status())
+	}
+
+	b, err := json.Marshal(e.Body("req-1", language.English))
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+	want := `{"code":"content_too_long","message":"content must be 200 characters or less","details":{"max":200},"error":"content must be 200 characters or less","request_id":"req-1"}`
+	if string(b) != want {
+		t.Errorf("Expected %s, got %s", want, b)
+	}
+
+	// details が空の場合は省略する
+	b, _ = json.Marshal(New(RateLimited).Body("", language.English))
+	if want := `{"code":"rate_limited","message":"Too many requests","error":"Too many requests"}`; string(b) != want {
+		t.Errorf("Expected %s, got %s", want, b)
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	// すべてのコードがステータスと各言語のメッセージを持つこと
+	for code, status := range statuses {
+		if status < 400 {
+			t.Errorf("Invalid status for %s: %d", code, status)
+		}
+		for _, lang := range supported {
+			if catalogs[lang][code] == "" {
+				t.Errorf("Missing %s message for %s", lang, code)
+			}
+		}
+	}
+	for _, lang := range supported {
+		for code := range catalogs[lang] {
+			if _, ok := statuses[code]; !ok {
+				t.Errorf("Unknown code %s in %s catalog", code, lang)
+			}
+		}
+	}
+
+	if got := New("no_such_code").Status(); got != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 for an unknown code, got %d", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	t.Cleanup(func() { SetFallbackLanguage("en") })
+
+	tests := []struct {
+		fallback       string
+		acceptLanguage string
+		want           language.Tag
+	}{
+		{"en", "", language.English},
+		{"en", "ja", language.Japanese},
+		{"en", "ja-JP,ja;q=0.9,en;q=0.8", language.Japanese},
+		{"en", "fr-FR, en;q=0.5", language.English},
+		{"en", "fr", language.English},
+		{"ja", "", language.Japanese},
+		{"ja", "fr", language.Japanese},
+		{"ja", "en-US", language.English},
+	}
+	for _, tt := range tests {
+		if err := SetFallbackLanguage(tt.fallback); err != nil {
+			t.Fatalf("SetFallbackLanguage(%q): %v", tt.fallback, err)
+		}
+		if got := Negotiate(tt.acceptLanguage); got != tt.want {
+			t.Errorf("Negotiate(%q) with fallback %s = %s, want %s", tt.acceptLanguage, tt.fallback, got, tt.want)
+		}
+	}
+
+	if err := SetFallbackLanguage("fr"); err == nil {
+		t.Error("Expected an error for an unsupported language")
+	}
+
+	if got := New(ContentTooLong, "max", 200).Message(language.Japanese); got != "content は200文字以内で入力してください" {
+		t.Errorf("Unexpected Japanese message: %s", got)
+	}
+}
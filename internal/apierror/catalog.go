@@ -0,0 +1,99 @@
+package apierror
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/text/language"
+)
+
+// catalogFS holds a message catalog per language, mapping codes to message
+// templates. {name} はメッセージの詳細（details）の同名の値に置き換えられる
+//
+//go:embed messages/*.json
+var catalogFS embed.FS
+
+// supported lists the languages that have a message catalog
+var supported = []language.Tag{language.English, language.Japanese}
+
+var catalogs = loadCatalogs()
+
+// negotiator matches Accept-Language against supported, falling back to
+// tags[0] when nothing matches
+type negotiator struct {
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+var current atomic.Pointer[negotiator]
+
+func init() {
+	current.Store(newNegotiator(language.English))
+}
+
+func loadCatalogs() map[language.Tag]map[Code]string {
+	catalogs := make(map[language.Tag]map[Code]string, len(supported))
+	for _, tag := range supported {
+		// カタログはバイナリに埋め込まれているため、読めない場合はビルドの誤り
+		b, err := catalogFS.ReadFile("messages/" + tag.String() + ".json")
+		if err != nil {
+			panic(err)
+		}
+		var messages map[Code]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic(fmt.Sprintf("apierror: invalid catalog %s: %v", tag, err))
+		}
+		catalogs[tag] = messages
+	}
+	return catalogs
+}
+
+func newNegotiator(fallback language.Tag) *negotiator {
+	tags := []language.Tag{fallback}
+	for _, tag := range supported {
+		if tag != fallback {
+			tags = append(tags, tag)
+		}
+	}
+	return &negotiator{tags: tags, matcher: language.NewMatcher(tags)}
+}
+
+// SetFallbackLanguage sets the language used when Accept-Language is missing
+// or matches no catalog. lang is a BCP 47 tag such as "ja" or "en-US"
+func SetFallbackLanguage(lang string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return fmt.Errorf("invalid language %q: %w", lang, err)
+	}
+	_, i, confidence := language.NewMatcher(supported).Match(tag)
+	if confidence == language.No {
+		return fmt.Errorf("unsupported language %q", lang)
+	}
+	current.Store(newNegotiator(supported[i]))
+	return nil
+}
+
+// Negotiate returns the supported language that best matches the
+// Accept-Language header value acceptLanguage
+func Negotiate(acceptLanguage string) language.Tag {
+	n := current.Load()
+	_, i := language.MatchStrings(n.matcher, acceptLanguage)
+	return n.tags[i]
+}
+
+// lookup returns the message template of code in lang, falling back to the
+// fallback language and then to the message of InternalError
+func lookup(lang language.Tag, code Code) string {
+	if message, ok := catalogs[lang][code]; ok {
+		return message
+	}
+	if message, ok := catalogs[current.Load().tags[0]][code]; ok {
+		return message
+	}
+	if code != InternalError {
+		return lookup(lang, InternalError)
+	}
+	return "Internal server error"
+}
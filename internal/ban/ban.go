@@ -0,0 +1,236 @@
+// Package ban maintains the IP/CIDR ban list.
+//
+// Bans are persisted in the ip_bans table and cached in memory so that the
+// middleware can check every request without a query. The cache is reloaded
+// periodically to pick up bans added by other instances.
+//
+// ShadowList works the same way for shadow bans (the shadow_bans table),
+// which hide a client's posts from everyone else instead of rejecting them.
+package ban
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fuwapachi/internal/model"
+)
+
+// ErrInvalidCIDR is returned for addresses that are neither an IP nor a CIDR
+var ErrInvalidCIDR = errors.New("invalid IP address or CIDR")
+
+type entry struct {
+	ban    model.Ban
+	prefix netip.Prefix
+}
+
+// List is the in-memory cache of active bans
+type List struct {
+	db *sql.DB
+
+	mu      sync.RWMutex
+	entries []entry
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewList creates an empty List backed by db. Call Refresh to load the bans.
+func NewList(db *sql.DB) *List {
+	return &List{
+		db:   db,
+		done: make(chan struct{}),
+	}
+}
+
+// ParsePrefix parses an IP address (as a single-address prefix) or a CIDR
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, ErrInvalidCIDR
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, ErrInvalidCIDR
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Refresh reloads the active bans from the database
+func (l *List) Refresh(ctx context.Context) error {
+	rows, err := l.db.QueryContext(ctx, "SELECT id, cidr, reason, created_by, created_at, expires_at FROM ip_bans WHERE expires_at IS NULL OR expires_at > ?", time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to load bans: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []entry
+	for rows.Next() {
+		var id int64
+		var b model.Ban
+		var reason sql.NullString
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&id, &b.CIDR, &reason, &b.CreatedBy, &b.CreatedAt, &expiresAt); err != nil {
+			return fmt.Errorf("failed to load bans: %w", err)
+		}
+		prefix, err := ParsePrefix(b.CIDR)
+		if err != nil {
+			slog.Warn("skipping ban with invalid CIDR", "ban_id", id, "cidr", b.CIDR)
+			continue
+		}
+		b.ID = strconv.FormatInt(id, 10)
+		b.Reason = reason.String
+		if expiresAt.Valid {
+			b.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, entry{ban: b, prefix: prefix})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load bans: %w", err)
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch refreshes the cache every interval until Close is called
+func (l *List) Watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.Refresh(context.Background()); err != nil {
+			slog.Error("failed to refresh bans", "error", err)
+		}
+	}
+}
+
+// Close stops Watch
+func (l *List) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Lookup returns the active ban covering ip, if any
+func (l *List) Lookup(ip string) (model.Ban, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return model.Ban{}, false
+	}
+	addr = addr.Unmap()
+
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, e := range l.entries {
+		if e.ban.ExpiresAt != nil && !e.ban.ExpiresAt.After(now) {
+			continue
+		}
+		if e.prefix.Contains(addr) {
+			return e.ban, true
+		}
+	}
+	return model.Ban{}, false
+}
+
+// Active returns the active bans
+func (l *List) Active() []model.Ban {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	bans := []model.Ban{}
+	for _, e := range l.entries {
+		if e.ban.ExpiresAt != nil && !e.ban.ExpiresAt.After(now) {
+			continue
+		}
+		bans = append(bans, e.ban)
+	}
+	return bans
+}
+
+// Add stores a ban, replacing any existing ban of the same range
+func (l *List) Add(ctx context.Context, b model.Ban) (model.Ban, error) {
+	prefix, err := ParsePrefix(b.CIDR)
+	if err != nil {
+		return model.Ban{}, err
+	}
+	b.CIDR = prefix.String()
+
+	// 同じ範囲の禁止は上書きし、LAST_INSERT_ID で既存の行の id を返す
+	result, err := l.db.ExecContext(ctx, `INSERT INTO ip_bans (cidr, reason, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), reason = VALUES(reason), created_by = VALUES(created_by),
+			created_at = VALUES(created_at), expires_at = VALUES(expires_at)`,
+		b.CIDR, b.Reason, b.CreatedBy, b.CreatedAt, b.ExpiresAt)
+	if err != nil {
+		return model.Ban{}, fmt.Errorf("failed to store ban: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return model.Ban{}, fmt.Errorf("failed to store ban: %w", err)
+	}
+	b.ID = strconv.FormatInt(id, 10)
+
+	l.mu.Lock()
+	entries := make([]entry, 0, len(l.entries)+1)
+	for _, e := range l.entries {
+		if e.prefix != prefix {
+			entries = append(entries, e)
+		}
+	}
+	l.entries = append(entries, entry{ban: b, prefix: prefix})
+	l.mu.Unlock()
+
+	return b, nil
+}
+
+// Remove deletes the ban with id and reports whether it existed
+func (l *List) Remove(ctx context.Context, id string) (bool, error) {
+	result, err := l.db.ExecContext(ctx, "DELETE FROM ip_bans WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove ban: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove ban: %w", err)
+	}
+
+	l.mu.Lock()
+	entries := make([]entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if e.ban.ID != id {
+			entries = append(entries, e)
+		}
+	}
+	l.entries = entries
+	l.mu.Unlock()
+
+	return n > 0, nil
+}
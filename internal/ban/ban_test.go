@@ -0,0 +1,101 @@
+package ban
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/model"
+)
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"203.0.113.5", "203.0.113.5/32"},
+		{"203.0.113.77/24", "203.0.113.0/24"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"::ffff:203.0.113.5", "203.0.113.5/32"},
+	}
+	for _, tt := range tests {
+		got, err := ParsePrefix(tt.in)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("ParsePrefix(%q) = %v, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := ParsePrefix("not-an-ip"); err != ErrInvalidCIDR {
+		t.Errorf("Expected ErrInvalidCIDR, got %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, cidr, reason, created_by, created_at, expires_at FROM ip_bans").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "cidr", "reason", "created_by", "created_at", "expires_at"}).
+			AddRow(1, "203.0.113.0/24", "troll", "admin", now, nil).
+			AddRow(2, "198.51.100.7/32", nil, "admin", now, now.Add(-time.Second)))
+
+	l := NewList(db)
+	if err := l.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	if b, ok := l.Lookup("203.0.113.99"); !ok || b.ID != "1" {
+		t.Errorf("Expected 203.0.113.99 to be banned by 1, got %+v %v", b, ok)
+	}
+	if _, ok := l.Lookup("203.0.114.1"); ok {
+		t.Error("203.0.114.1 should not be banned")
+	}
+	// 期限切れの禁止は無視する
+	if _, ok := l.Lookup("198.51.100.7"); ok {
+		t.Error("Expired ban should not apply")
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO ip_bans").
+		WithArgs("192.0.2.0/24", "spam", "alice", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("DELETE FROM ip_bans WHERE id = \\?").WithArgs("5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	l := NewList(db)
+	b, err := l.Add(context.Background(), model.Ban{CIDR: "192.0.2.10/24", Reason: "spam", CreatedBy: "alice", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if b.ID != "5" || b.CIDR != "192.0.2.0/24" {
+		t.Errorf("Unexpected ban %+v", b)
+	}
+	if _, ok := l.Lookup("192.0.2.1"); !ok {
+		t.Error("Added ban should apply immediately")
+	}
+
+	removed, err := l.Remove(context.Background(), "5")
+	if err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if _, ok := l.Lookup("192.0.2.1"); ok {
+		t.Error("Removed ban should no longer apply")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
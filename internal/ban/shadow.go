@@ -0,0 +1,213 @@
+package ban
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"fuwapachi/internal/model"
+)
+
+// Shadow-banned actor types (the same as the audit log's actor_type)
+const (
+	ActorIP    = "ip"
+	ActorToken = "token"
+)
+
+// ErrInvalidActor is returned for shadow bans whose actor type is unknown or
+// whose actor ID is not an IP address (ip) or a SHA-256 hex digest (token)
+var ErrInvalidActor = errors.New("invalid shadow ban actor")
+
+type shadowKey struct {
+	actorType string
+	actorID   string
+}
+
+// ShadowList is the in-memory cache of shadow-banned clients, identified by
+// IP address or by the hash of their X-Client-Token
+type ShadowList struct {
+	db *sql.DB
+
+	mu      sync.RWMutex
+	entries map[shadowKey]model.ShadowBan
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewShadowList creates an empty ShadowList backed by db. Call Refresh to load it.
+func NewShadowList(db *sql.DB) *ShadowList {
+	return &ShadowList{
+		db:      db,
+		entries: make(map[shadowKey]model.ShadowBan),
+		done:    make(chan struct{}),
+	}
+}
+
+// Refresh reloads the shadow bans from the database
+func (l *ShadowList) Refresh(ctx context.Context) error {
+	rows, err := l.db.QueryContext(ctx, "SELECT actor_type, actor_id, reason, created_by, created_at FROM shadow_bans")
+	if err != nil {
+		return fmt.Errorf("failed to load shadow bans: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[shadowKey]model.ShadowBan)
+	for rows.Next() {
+		var b model.ShadowBan
+		var reason sql.NullString
+		if err := rows.Scan(&b.ActorType, &b.ActorID, &reason, &b.CreatedBy, &b.CreatedAt); err != nil {
+			return fmt.Errorf("failed to load shadow bans: %w", err)
+		}
+		b.Reason = reason.String
+		entries[shadowKey{b.ActorType, b.ActorID}] = b
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load shadow bans: %w", err)
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch refreshes the cache every interval until Close is called
+func (l *ShadowList) Watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.Refresh(context.Background()); err != nil {
+			slog.Error("failed to refresh shadow bans", "error", err)
+		}
+	}
+}
+
+// Close stops Watch
+func (l *ShadowList) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Contains reports whether the client with the given IP address or token
+// hash (empty when the client sent no token) is shadow-banned
+func (l *ShadowList) Contains(ip, tokenKey string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.entries) == 0 {
+		return false
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		ip = addr.Unmap().String()
+	}
+	if _, ok := l.entries[shadowKey{ActorIP, ip}]; ok {
+		return true
+	}
+	if tokenKey != "" {
+		if _, ok := l.entries[shadowKey{ActorToken, tokenKey}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the shadow bans, oldest first
+func (l *ShadowList) Active() []model.ShadowBan {
+	l.mu.RLock()
+	bans := make([]model.ShadowBan, 0, len(l.entries))
+	for _, b := range l.entries {
+		bans = append(bans, b)
+	}
+	l.mu.RUnlock()
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt.Before(bans[j].CreatedAt)
+	})
+	return bans
+}
+
+// NormalizeActor validates a shadow-banned actor and returns the actor ID in
+// the form used as the cache key (IP addresses without the IPv4-mapped prefix,
+// token hashes in lower case)
+func NormalizeActor(actorType, actorID string) (string, error) {
+	switch actorType {
+	case ActorIP:
+		addr, err := netip.ParseAddr(actorID)
+		if err != nil {
+			return "", ErrInvalidActor
+		}
+		return addr.Unmap().String(), nil
+	case ActorToken:
+		sum, err := hex.DecodeString(actorID)
+		if err != nil || len(sum) != 32 {
+			return "", ErrInvalidActor
+		}
+		return hex.EncodeToString(sum), nil
+	}
+	return "", ErrInvalidActor
+}
+
+// Add stores a shadow ban, replacing the reason of an existing one
+func (l *ShadowList) Add(ctx context.Context, b model.ShadowBan) (model.ShadowBan, error) {
+	actorID, err := NormalizeActor(b.ActorType, b.ActorID)
+	if err != nil {
+		return model.ShadowBan{}, err
+	}
+	b.ActorID = actorID
+
+	_, err = l.db.ExecContext(ctx, `INSERT INTO shadow_bans (actor_type, actor_id, reason, created_by, created_at) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE reason = VALUES(reason), created_by = VALUES(created_by), created_at = VALUES(created_at)`,
+		b.ActorType, b.ActorID, b.Reason, b.CreatedBy, b.CreatedAt)
+	if err != nil {
+		return model.ShadowBan{}, fmt.Errorf("failed to store shadow ban: %w", err)
+	}
+
+	l.mu.Lock()
+	l.entries[shadowKey{b.ActorType, b.ActorID}] = b
+	l.mu.Unlock()
+	return b, nil
+}
+
+// Remove deletes a shadow ban and reports whether it existed
+func (l *ShadowList) Remove(ctx context.Context, actorType, actorID string) (bool, error) {
+	actorID, err := NormalizeActor(actorType, actorID)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := l.db.ExecContext(ctx, "DELETE FROM shadow_bans WHERE actor_type = ? AND actor_id = ?", actorType, actorID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove shadow ban: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove shadow ban: %w", err)
+	}
+
+	l.mu.Lock()
+	delete(l.entries, shadowKey{actorType, actorID})
+	l.mu.Unlock()
+
+	return n > 0, nil
+}
@@ -0,0 +1,83 @@
+package ban
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/model"
+)
+
+func TestShadowListContains(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	tokenKey := strings.Repeat("ab", 32)
+	now := time.Now()
+	mock.ExpectQuery("SELECT actor_type, actor_id, reason, created_by, created_at FROM shadow_bans").
+		WillReturnRows(sqlmock.NewRows([]string{"actor_type", "actor_id", "reason", "created_by", "created_at"}).
+			AddRow(ActorIP, "203.0.113.5", "spam", "admin", now).
+			AddRow(ActorToken, tokenKey, nil, "admin", now))
+
+	l := NewShadowList(db)
+	if err := l.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	if !l.Contains("203.0.113.5", "") {
+		t.Error("Expected 203.0.113.5 to be shadow-banned")
+	}
+	if !l.Contains("::ffff:203.0.113.5", "") {
+		t.Error("Expected the IPv4-mapped address to be shadow-banned")
+	}
+	if !l.Contains("198.51.100.1", tokenKey) {
+		t.Error("Expected the token to be shadow-banned from any IP")
+	}
+	if l.Contains("198.51.100.1", "") {
+		t.Error("198.51.100.1 should not be shadow-banned")
+	}
+}
+
+func TestShadowListAddAndRemove(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO shadow_bans").
+		WithArgs(ActorIP, "192.0.2.1", "flood", "alice", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM shadow_bans WHERE actor_type = \\? AND actor_id = \\?").WithArgs(ActorIP, "192.0.2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	l := NewShadowList(db)
+	if _, err := l.Add(context.Background(), model.ShadowBan{ActorType: ActorIP, ActorID: "::ffff:192.0.2.1", Reason: "flood", CreatedBy: "alice", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if !l.Contains("192.0.2.1", "") {
+		t.Error("Added shadow ban should apply immediately")
+	}
+
+	removed, err := l.Remove(context.Background(), ActorIP, "192.0.2.1")
+	if err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if l.Contains("192.0.2.1", "") {
+		t.Error("Removed shadow ban should no longer apply")
+	}
+
+	if _, err := l.Add(context.Background(), model.ShadowBan{ActorType: ActorToken, ActorID: "not-a-hash"}); err != ErrInvalidActor {
+		t.Errorf("Expected ErrInvalidActor, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Package broadcast distributes WebSocket events between server instances.
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"fuwapachi/internal/model"
+)
+
+// Envelope is an encoded event travelling across a Backplane
+type Envelope struct {
+	Type string
+	// Payload はWebSocketクライアントにそのまま送信されるJSON
+	Payload json.RawMessage
+}
+
+// Encode converts an event into an Envelope
+func Encode(event model.Event) (Envelope, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to encode %s event: %w", event.EventType(), err)
+	}
+	return Envelope{Type: event.EventType(), Payload: payload}, nil
+}
+
+// Backplane is a pub/sub transport for WebSocket events.
+//
+// Every event published on any instance is delivered exactly once to the
+// channel returned by Subscribe on every instance, including the publisher.
+// Each instance is expected to have a single subscriber (Handler.HandleBroadcast).
+type Backplane interface {
+	Publish(ctx context.Context, env Envelope) error
+	Subscribe() <-chan Envelope
+	Close() error
+}
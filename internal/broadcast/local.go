@@ -0,0 +1,56 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when publishing to a closed Backplane
+var ErrClosed = errors.New("broadcast: backplane closed")
+
+// Local is an in-process Backplane for single-instance deployments
+type Local struct {
+	mu     sync.RWMutex
+	ch     chan Envelope
+	closed bool
+}
+
+// NewLocal creates a Local backplane with the given buffer size
+func NewLocal(buffer int) *Local {
+	return &Local{ch: make(chan Envelope, buffer)}
+}
+
+// Publish implements Backplane
+func (l *Local) Publish(ctx context.Context, env Envelope) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	select {
+	case l.ch <- env:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe implements Backplane
+func (l *Local) Subscribe() <-chan Envelope {
+	return l.ch
+}
+
+// Close implements Backplane
+func (l *Local) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.ch)
+	}
+	return nil
+}
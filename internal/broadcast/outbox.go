@@ -0,0 +1,219 @@
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// outboxBatchSize は1回のポーリングで読み込む最大イベント数
+	outboxBatchSize = 200
+	// outboxGapTimeout はAUTO_INCREMENTの欠番を未コミットの行として待つ時間。
+	// これを過ぎた欠番はロールバックされたものとみなす
+	outboxGapTimeout = 10 * time.Second
+	// outboxMaxGap はこれより大きい欠番の範囲を追跡しない
+	// （auto_increment_offset の変更などで発生する巨大なジャンプ対策）
+	outboxMaxGap = 1000
+	// outboxCleanupInterval は古いイベントを削除する間隔
+	outboxCleanupInterval = time.Minute
+)
+
+// Outbox is a Backplane backed by the broadcast_events table.
+//
+// Publish inserts a row and every instance polls the table, delivering rows
+// in id order. Ids that are skipped while another transaction is still in
+// flight are re-checked for outboxGapTimeout so that late commits are not lost.
+type Outbox struct {
+	db        *sql.DB
+	interval  time.Duration
+	retention time.Duration
+
+	out       chan Envelope
+	done      chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+
+	lastID int64
+	gaps   map[int64]time.Time
+}
+
+// NewOutbox creates an Outbox polling every interval and keeping rows for retention
+func NewOutbox(db *sql.DB, interval, retention time.Duration) *Outbox {
+	return &Outbox{
+		db:        db,
+		interval:  interval,
+		retention: retention,
+		out:       make(chan Envelope, 100),
+		done:      make(chan struct{}),
+		gaps:      make(map[int64]time.Time),
+	}
+}
+
+// Publish implements Backplane
+func (o *Outbox) Publish(ctx context.Context, env Envelope) error {
+	_, err := o.db.ExecContext(ctx, "INSERT INTO broadcast_events (type, payload, created_at) VALUES (?, ?, ?)",
+		env.Type, string(env.Payload), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", env.Type, err)
+	}
+	return nil
+}
+
+// Subscribe implements Backplane. Polling starts on the first call and
+// only events published after that point are delivered.
+func (o *Outbox) Subscribe() <-chan Envelope {
+	o.startOnce.Do(func() {
+		go o.run()
+	})
+	return o.out
+}
+
+// Close implements Backplane
+func (o *Outbox) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.done)
+	})
+	return nil
+}
+
+func (o *Outbox) run() {
+	defer close(o.out)
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	// 起動時点の最新IDから購読を開始する（過去のイベントは再送しない）
+	for {
+		err := o.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM broadcast_events").Scan(&o.lastID)
+		if err == nil {
+			break
+		}
+		slog.Error("failed to read outbox position", "error", err)
+		select {
+		case <-o.done:
+			return
+		case <-ticker.C:
+		}
+	}
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := o.poll(time.Now()); err != nil {
+			slog.Error("failed to poll outbox", "error", err)
+		}
+
+		if o.retention > 0 && time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			if _, err := o.db.Exec("DELETE FROM broadcast_events WHERE created_at < ?", time.Now().Add(-o.retention)); err != nil {
+				slog.Error("failed to clean up outbox", "error", err)
+			}
+		}
+	}
+}
+
+// poll reads new rows and rows filling previously seen gaps
+func (o *Outbox) poll(now time.Time) error {
+	rows, err := o.db.Query("SELECT id, type, payload FROM broadcast_events WHERE id > ? ORDER BY id LIMIT ?",
+		o.lastID, outboxBatchSize)
+	if err != nil {
+		return err
+	}
+	fresh, err := scanEnvelopes(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range fresh {
+		if gap := row.id - o.lastID - 1; gap > 0 && gap <= outboxMaxGap {
+			for id := o.lastID + 1; id < row.id; id++ {
+				o.gaps[id] = now
+			}
+		}
+		o.lastID = row.id
+		if !o.deliver(row.env) {
+			return nil
+		}
+	}
+
+	return o.pollGaps(now)
+}
+
+// pollGaps delivers rows whose ids were skipped by an earlier poll
+func (o *Outbox) pollGaps(now time.Time) error {
+	if len(o.gaps) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(o.gaps))
+	for id, seen := range o.gaps {
+		if now.Sub(seen) > outboxGapTimeout {
+			delete(o.gaps, id)
+			continue
+		}
+		args = append(args, id)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf("SELECT id, type, payload FROM broadcast_events WHERE id IN (%s) ORDER BY id",
+		strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", "))
+	rows, err := o.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	late, err := scanEnvelopes(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range late {
+		delete(o.gaps, row.id)
+		if !o.deliver(row.env) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliver sends env to the subscriber and reports false once the outbox is closed
+func (o *Outbox) deliver(env Envelope) bool {
+	select {
+	case o.out <- env:
+		return true
+	case <-o.done:
+		return false
+	}
+}
+
+type outboxRow struct {
+	id  int64
+	env Envelope
+}
+
+func scanEnvelopes(rows *sql.Rows) ([]outboxRow, error) {
+	defer rows.Close()
+
+	var result []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		var payload string
+		if err := rows.Scan(&row.id, &row.env.Type, &payload); err != nil {
+			return nil, err
+		}
+		row.env.Payload = []byte(payload)
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,113 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestOutbox_DeliversLateCommitsOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	o := NewOutbox(db, time.Second, time.Hour)
+	now := time.Now()
+
+	// 1回目: id=2 が未コミットのため 1, 3 のみ見える
+	mock.ExpectQuery("SELECT id, type, payload FROM broadcast_events WHERE id > ").
+		WithArgs(int64(0), outboxBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}).
+			AddRow(1, "message_deleted", `{"id":"1"}`).
+			AddRow(3, "message_deleted", `{"id":"3"}`))
+	mock.ExpectQuery("SELECT id, type, payload FROM broadcast_events WHERE id IN ").
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}))
+
+	// 2回目: id=2 がコミットされ、欠番の再確認で配信される
+	mock.ExpectQuery("SELECT id, type, payload FROM broadcast_events WHERE id > ").
+		WithArgs(int64(3), outboxBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}))
+	mock.ExpectQuery("SELECT id, type, payload FROM broadcast_events WHERE id IN ").
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}).
+			AddRow(2, "message_deleted", `{"id":"2"}`))
+
+	if err := o.poll(now); err != nil {
+		t.Fatalf("first poll failed: %v", err)
+	}
+	if err := o.poll(now.Add(time.Second)); err != nil {
+		t.Fatalf("second poll failed: %v", err)
+	}
+
+	var got []string
+	for len(o.out) > 0 {
+		got = append(got, string((<-o.out).Payload))
+	}
+
+	want := []string{`{"id":"1"}`, `{"id":"3"}`, `{"id":"2"}`}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d events, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+
+	if len(o.gaps) != 0 {
+		t.Errorf("Expected gap to be resolved, still tracking %v", o.gaps)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutbox_ExpiresStaleGaps(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	o := NewOutbox(db, time.Second, time.Hour)
+	o.lastID = 5
+	o.gaps[4] = time.Now().Add(-2 * outboxGapTimeout)
+
+	mock.ExpectQuery("SELECT id, type, payload FROM broadcast_events WHERE id > ").
+		WithArgs(int64(5), outboxBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "payload"}))
+
+	if err := o.poll(time.Now()); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	if len(o.gaps) != 0 {
+		t.Errorf("Expected stale gap to be dropped, still tracking %v", o.gaps)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLocal_PublishAfterClose(t *testing.T) {
+	l := NewLocal(1)
+
+	if err := l.Publish(context.Background(), Envelope{Type: "message_deleted"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if env := <-l.Subscribe(); env.Type != "message_deleted" {
+		t.Errorf("Expected message_deleted, got %s", env.Type)
+	}
+
+	l.Close()
+	if err := l.Publish(context.Background(), Envelope{}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package captcha verifies CAPTCHA response tokens with an external provider.
+//
+// HTTPVerifier speaks the siteverify protocol shared by hCaptcha, Cloudflare
+// Turnstile and reCAPTCHA: the secret, the token and the client IP are posted
+// as a form, and the provider answers with {"success": true|false, ...}.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Verifier checks a CAPTCHA response token sent by a client.
+// A rejected token is reported as (false, nil); an error means the token
+// could not be checked (e.g. the provider is unreachable).
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// HTTPVerifier verifies tokens against a siteverify endpoint
+type HTTPVerifier struct {
+	verifyURL string
+	secret    string
+	client    *http.Client
+}
+
+// NewHTTPVerifier creates a verifier for the provider at verifyURL
+func NewHTTPVerifier(verifyURL, secret string, timeout time.Duration) *HTTPVerifier {
+	return &HTTPVerifier{
+		verifyURL: verifyURL,
+		secret:    secret,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// verifyResponse is the response body of a siteverify endpoint
+type verifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify implements Verifier
+func (v *HTTPVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("captcha provider unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+	}
+
+	var result verifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result); err != nil {
+		return false, fmt.Errorf("invalid captcha provider response: %w", err)
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,50 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "s3cret" {
+			t.Errorf("Unexpected secret %q", r.FormValue("secret"))
+		}
+		if r.FormValue("remoteip") != "192.0.2.1" {
+			t.Errorf("Unexpected remoteip %q", r.FormValue("remoteip"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success": %t}`, r.FormValue("response") == "good")
+	}))
+	defer server.Close()
+
+	v := NewHTTPVerifier(server.URL, "s3cret", time.Second)
+
+	if ok, err := v.Verify(context.Background(), "good", "192.0.2.1"); !ok || err != nil {
+		t.Errorf("Verify(good) = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := v.Verify(context.Background(), "bad", "192.0.2.1"); ok || err != nil {
+		t.Errorf("Verify(bad) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestHTTPVerifier_ProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	v := NewHTTPVerifier(server.URL, "s3cret", time.Second)
+	if _, err := v.Verify(context.Background(), "good", ""); err == nil {
+		t.Error("Expected an error for a failing provider")
+	}
+
+	server.Close()
+	if _, err := v.Verify(context.Background(), "good", ""); err == nil {
+		t.Error("Expected an error for an unreachable provider")
+	}
+}
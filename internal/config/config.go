@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds application configuration
@@ -18,8 +20,92 @@ type Config struct {
 	ServerPort string
 	Env        string
 
+	// ErrorLanguage はエラーメッセージの既定の言語（en または ja）。
+	// Accept-Language がない場合や対応していない言語の場合に使う
+	ErrorLanguage string
+
 	// CORS設定
 	AllowedOrigins []string
+
+	// ブロードキャスト設定
+	// BroadcastBackend は "local"（単一プロセス）または "database"（outboxテーブル経由）
+	BroadcastBackend      string
+	BroadcastPollInterval time.Duration
+	BroadcastRetention    time.Duration
+
+	// PresenceInterval は接続数イベントを送信する最小間隔
+	PresenceInterval time.Duration
+
+	// MaxMessagesPerRequest は GET /messages の count パラメータの上限
+	MaxMessagesPerRequest int
+
+	// SearchBackend は "like"（LIKE による全件走査）または "fulltext"（ngram パーサの FULLTEXT インデックス）。
+	// fulltext でもインデックスがない場合は起動時に like に切り替える
+	SearchBackend string
+
+	// IdempotencyTTL は Idempotency-Key とレスポンスを保存する期間
+	IdempotencyTTL time.Duration
+
+	// 重複・連投検知
+	// DuplicateWindow 内に同じ投稿者（IPアドレス）による正規化後の内容が同じメッセージが
+	// DuplicateThreshold 件以上あれば DuplicateAction（"reject" または "quarantine"）を適用する。
+	// 投稿者に関係なく DuplicateGlobalThreshold 件以上あれば承認待ちにする（よくある短い挨拶などを
+	// 巻き込まないよう拒否はせず、閾値も投稿者ごとより高くする）。いずれも 0 で無効
+	DuplicateThreshold       int
+	DuplicateGlobalThreshold int
+	DuplicateWindow          time.Duration
+	DuplicateAction          string
+
+	// NGワードフィルター
+	// NGWordFile が空の場合は無効。ファイルは NGWordReloadInterval ごとに再読み込みする
+	NGWordFile           string
+	NGWordReloadInterval time.Duration
+
+	// ReportHideThreshold は異なるクライアントからの通報がこの件数に達したメッセージを非表示にする。0 で無効
+	ReportHideThreshold int
+
+	// モデレーション
+	// AdminToken は管理API（/admin/...）の Bearer トークン（管理者名は admin）
+	// AdminTokens は管理者ごとのトークン（"name:token" のカンマ区切り）。名前は監査ログに記録される。
+	// どちらも空の場合は管理APIを無効にする
+	AdminToken  string
+	AdminTokens string
+	// ModerationPreApproval が true の場合、新しいメッセージはすべて承認待ちになる
+	ModerationPreApproval bool
+
+	// BanRefreshInterval は IP/CIDR の禁止リストをデータベースから再読み込みする間隔
+	BanRefreshInterval time.Duration
+
+	// ThreadDeleteCascade が true の場合、メッセージの削除時に返信も削除する
+	ThreadDeleteCascade bool
+
+	// プルーフ・オブ・ワーク
+	// PowEnabled が true の場合、POST /messages に GET /challenge で取得したチャレンジの解が必要になる。
+	// 難易度（先頭の0ビット数）は PowDifficulty から、レート制限の消費具合に応じて PowMaxDifficulty まで上がる
+	PowEnabled       bool
+	PowSecret        string
+	PowDifficulty    int
+	PowMaxDifficulty int
+	PowTTL           time.Duration
+
+	// CAPTCHA
+	// CaptchaVerifyURL は siteverify 互換の検証エンドポイント（hCaptcha / Turnstile など）。空の場合は無効
+	// CaptchaFailOpen が true の場合、検証サービスに接続できないときは検証なしで投稿を受け付ける
+	CaptchaVerifyURL string
+	CaptchaSecret    string
+	CaptchaTimeout   time.Duration
+	CaptchaFailOpen  bool
+
+	// MetricsAddr を設定すると GET /metrics をこのアドレス（例: 127.0.0.1:9090）の別のリスナーでのみ公開する。
+	// 空の場合はメインのポートで公開し、管理APIと同じ Bearer トークンを要求する
+	MetricsAddr string
+
+	// トレーシング（OpenTelemetry）
+	// TracingExporter は none / otlp / stdout。otlp の送信先は OTEL_EXPORTER_OTLP_ENDPOINT などの標準の環境変数で指定する。
+	// TracingFile は stdout エクスポーターの出力先（空の場合は標準出力）
+	TracingExporter    string
+	TracingFile        string
+	TracingSampleRatio float64
 }
 
 // Load loads configuration from environment variables
@@ -62,6 +148,55 @@ func Load() Config {
 		ServerPort:     serverPort,
 		Env:            env,
 		AllowedOrigins: strings.Split(allowedOrigins, ","),
+
+		ErrorLanguage: getEnv("ERROR_LANGUAGE", "en"),
+
+		BroadcastBackend:      getEnv("BROADCAST_BACKEND", "local"),
+		BroadcastPollInterval: getEnvDuration("BROADCAST_POLL_INTERVAL", 500*time.Millisecond),
+		BroadcastRetention:    getEnvDuration("BROADCAST_RETENTION", time.Hour),
+
+		PresenceInterval: getEnvDuration("PRESENCE_INTERVAL", 2*time.Second),
+
+		MaxMessagesPerRequest: getEnvInt("MAX_MESSAGES_PER_REQUEST", 50),
+
+		SearchBackend: getEnv("SEARCH_BACKEND", "like"),
+
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		DuplicateThreshold:       getEnvInt("DUPLICATE_THRESHOLD", 3),
+		DuplicateGlobalThreshold: getEnvInt("DUPLICATE_GLOBAL_THRESHOLD", 10),
+		DuplicateWindow:          getEnvDuration("DUPLICATE_WINDOW", 10*time.Minute),
+		DuplicateAction:          getEnv("DUPLICATE_ACTION", "reject"),
+
+		NGWordFile:           getEnv("NGWORD_FILE", ""),
+		NGWordReloadInterval: getEnvDuration("NGWORD_RELOAD_INTERVAL", 10*time.Second),
+
+		ReportHideThreshold: getEnvInt("REPORT_HIDE_THRESHOLD", 5),
+
+		AdminToken:            getEnv("ADMIN_TOKEN", ""),
+		AdminTokens:           getEnv("ADMIN_TOKENS", ""),
+		ModerationPreApproval: getEnvBool("MODERATION_PRE_APPROVAL", false),
+
+		BanRefreshInterval: getEnvDuration("BAN_REFRESH_INTERVAL", 30*time.Second),
+
+		ThreadDeleteCascade: getEnvBool("THREAD_DELETE_CASCADE", false),
+
+		MetricsAddr: getEnv("METRICS_ADDR", ""),
+
+		PowEnabled:       getEnvBool("POW_ENABLED", false),
+		PowSecret:        getEnv("POW_SECRET", ""),
+		PowDifficulty:    getEnvInt("POW_DIFFICULTY", 16),
+		PowMaxDifficulty: getEnvInt("POW_MAX_DIFFICULTY", 22),
+		PowTTL:           getEnvDuration("POW_TTL", 2*time.Minute),
+
+		CaptchaVerifyURL: getEnv("CAPTCHA_VERIFY_URL", ""),
+		CaptchaSecret:    getEnv("CAPTCHA_SECRET", ""),
+		CaptchaTimeout:   getEnvDuration("CAPTCHA_TIMEOUT", 5*time.Second),
+		CaptchaFailOpen:  getEnvBool("CAPTCHA_FAIL_OPEN", false),
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+		TracingFile:        getEnv("TRACING_FILE", ""),
+		TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
 	}
 
 	for i := range cfg.AllowedOrigins {
@@ -70,3 +205,48 @@ func Load() Config {
 
 	return cfg
 }
+
+// getEnv は環境変数を返し、未設定の場合は def を返す
+func getEnv(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt は環境変数を整数として返し、未設定・不正な値の場合は def を返す
+func getEnvInt(key string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// getEnvFloat は環境変数を浮動小数点数として返し、未設定・不正な値の場合は def を返す
+func getEnvFloat(key string, def float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(key)), 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+// getEnvBool は環境変数を真偽値として返し、未設定・不正な値の場合は def を返す
+func getEnvBool(key string, def bool) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// getEnvDuration は環境変数を time.Duration（例: "500ms", "1h"）として返し、
+// 未設定・不正な値の場合は def を返す
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return def
+	}
+	return d
+}
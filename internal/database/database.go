@@ -1,16 +1,26 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"fuwapachi/internal/config"
 )
 
+// hasParentSpan is an otelsql.SpanFilter creating spans only within a traced operation
+func hasParentSpan(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+	return trace.SpanContextFromContext(ctx).IsValid()
+}
+
 // Init initializes database connection
 func Init(cfg config.Config) (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
@@ -21,7 +31,13 @@ func Init(cfg config.Config) (*sql.DB, error) {
 		cfg.DBName,
 	)
 
-	db, err := sql.Open("mysql", dsn)
+	// リクエストなどのスパンの中の SQL 呼び出しにだけ OpenTelemetry のスパンを作る。
+	// アウトボックスのポーリングや定期的な再読み込みなど、親のないバックグラウンドの
+	// クエリでルートスパンが大量に作られないようにする
+	db, err := otelsql.Open("mysql", dsn,
+		otelsql.WithAttributes(semconv.DBSystemNameMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, SpanFilter: hasParentSpan}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -35,6 +51,6 @@ func Init(cfg config.Config) (*sql.DB, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	log.Println("✅ Database connection established")
+	slog.Info("database connection established")
 	return db, nil
 }
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHasParentSpan(t *testing.T) {
+	// バックグラウンドの呼び出し（親のスパンなし）ではスパンを作らない
+	if hasParentSpan(context.Background(), "", "", nil) {
+		t.Error("Expected no span without a parent")
+	}
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	if !hasParentSpan(trace.ContextWithSpanContext(context.Background(), parent), "", "", nil) {
+		t.Error("Expected a span within a parent span")
+	}
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// migration はバージョン付きのスキーマ変更
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	// apply はステートメントだけでは表現できない変更（サーバーの機能に応じた分岐など）に使う
+	apply func(db *sql.DB) error
+}
+
+// migrations は適用順に並べたスキーマ変更の一覧。
+// 既存のバージョンは書き換えず、変更は末尾に追加すること
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create messages",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS messages (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				content TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				deleted_at DATETIME NULL,
+				INDEX idx_deleted_at (deleted_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 2,
+		name:    "create broadcast_events",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS broadcast_events (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				type VARCHAR(64) NOT NULL,
+				payload TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				INDEX idx_broadcast_events_created_at (created_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 3,
+		name:    "create message_reactions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS message_reactions (
+				message_id INT NOT NULL,
+				kind VARCHAR(32) NOT NULL,
+				reactor_key CHAR(64) NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (message_id, kind, reactor_key)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add messages.parent_id",
+		statements: []string{
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id INT NULL AFTER content`,
+			`CREATE INDEX IF NOT EXISTS idx_parent_id ON messages (parent_id)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add messages created_at index",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_created_at_id ON messages (created_at, id)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "add messages content fulltext index",
+		apply:   createContentFulltextIndex,
+	},
+	{
+		version: 7,
+		name:    "create idempotency_keys",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				key_hash CHAR(64) PRIMARY KEY,
+				request_hash CHAR(64) NOT NULL,
+				status INT NOT NULL,
+				body TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				INDEX idx_idempotency_keys_created_at (created_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 8,
+		name:    "add messages.fingerprint and held_reason",
+		statements: []string{
+			`ALTER TABLE messages
+				ADD COLUMN IF NOT EXISTS fingerprint CHAR(64) NULL,
+				ADD COLUMN IF NOT EXISTS held_reason VARCHAR(64) NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_fingerprint_created_at ON messages (fingerprint, created_at)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "create message_reports",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS message_reports (
+				message_id INT NOT NULL,
+				reporter_key CHAR(64) NOT NULL,
+				reason VARCHAR(32) NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (message_id, reporter_key)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS hidden_at DATETIME NULL`,
+		},
+	},
+	{
+		version: 10,
+		name:    "add messages.status",
+		statements: []string{
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'approved'`,
+			`CREATE INDEX IF NOT EXISTS idx_status_id ON messages (status, id)`,
+			// 保留中のメッセージはモデレーション待ちに移す
+			`UPDATE messages SET status = 'pending' WHERE held_reason IS NOT NULL AND status = 'approved'`,
+		},
+	},
+	{
+		version: 11,
+		name:    "create audit_events",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_events (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				created_at DATETIME NOT NULL,
+				actor_type VARCHAR(16) NOT NULL,
+				actor_id VARCHAR(128) NOT NULL,
+				actor_ip VARCHAR(45) NULL,
+				action VARCHAR(32) NOT NULL,
+				target_id INT NULL,
+				reason VARCHAR(255) NULL,
+				INDEX idx_audit_events_created_at (created_at),
+				INDEX idx_audit_events_actor (actor_type, actor_id, created_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 12,
+		name:    "create ip_bans",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS ip_bans (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				cidr VARCHAR(64) NOT NULL,
+				reason VARCHAR(255) NULL,
+				created_by VARCHAR(128) NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NULL,
+				UNIQUE KEY uk_ip_bans_cidr (cidr),
+				INDEX idx_ip_bans_expires_at (expires_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 13,
+		name:    "create shadow_bans",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS shadow_bans (
+				actor_type VARCHAR(16) NOT NULL,
+				actor_id VARCHAR(128) NOT NULL,
+				reason VARCHAR(255) NULL,
+				created_by VARCHAR(128) NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (actor_type, actor_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			// シャドウバンされたクライアントの投稿は、投稿者のクライアント識別子を記録して本人にだけ表示する
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS shadow_key CHAR(64) NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_shadow_key ON messages (shadow_key)`,
+		},
+	},
+	{
+		version: 14,
+		name:    "unescape messages.content",
+		statements: []string{
+			// 以前は html.EscapeString した内容を保存していたため、生のテキストに戻す。
+			// &amp; を最後に戻すことで、元の内容に含まれていた "&lt;" などの文字列も正しく復元される
+			`UPDATE messages SET content = REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(content,
+				'&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&')
+				WHERE content LIKE '%&%'`,
+		},
+	},
+	{
+		version: 15,
+		name:    "add messages.author_key",
+		statements: []string{
+			// 同じ投稿者（IPアドレス）による同一内容の連投を数えるため、投稿者の識別子を記録する
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS author_key CHAR(64) NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_author_fingerprint_created_at ON messages (author_key, fingerprint, created_at)`,
+		},
+	},
+	{
+		version: 16,
+		name:    "create pow_used_challenges",
+		statements: []string{
+			// 解かれたプルーフ・オブ・ワークのチャレンジを期限まで記録し、インスタンスをまたいだ再利用を防ぐ
+			`CREATE TABLE IF NOT EXISTS pow_used_challenges (
+				token_hash CHAR(64) PRIMARY KEY,
+				expires_at DATETIME NOT NULL,
+				INDEX idx_pow_used_challenges_expires_at (expires_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 17,
+		name:    "add idempotency_keys.content_type",
+		statements: []string{
+			// 再送するレスポンスを最初と同じ表現（application/json か生テキストの表現か）として返すため、Content-Type を保存する
+			`ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS content_type VARCHAR(255) NOT NULL DEFAULT 'application/json'`,
+		},
+	},
+	{
+		version: 18,
+		name:    "add messages.shadow_token_key",
+		statements: []string{
+			// shadow_key は投稿者のIPアドレス、shadow_token_key は X-Client-Token の識別子を記録する。
+			// 以前の shadow_key はどちらか一方を記録していたため、両方のカラムにコピーしてどちらでも一致させる
+			`ALTER TABLE messages ADD COLUMN IF NOT EXISTS shadow_token_key CHAR(64) NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_shadow_token_key ON messages (shadow_token_key)`,
+			`UPDATE messages SET shadow_token_key = shadow_key WHERE shadow_key IS NOT NULL AND shadow_token_key IS NULL`,
+		},
+	},
+}
+
+// createContentFulltextIndex creates a FULLTEXT index on messages.content,
+// using the ngram parser (for Japanese) when the server supports it.
+// インデックスを作れなくても失敗にはしない。SEARCH_BACKEND=fulltext は起動時に
+// ResolveSearchBackend がインデックスを確認し、ngram でなければ like に切り替える
+func createContentFulltextIndex(db *sql.DB) error {
+	_, err := db.Exec("CREATE FULLTEXT INDEX ft_content ON messages (content) WITH PARSER ngram")
+	if err == nil {
+		return nil
+	}
+	slog.Warn("ngram parser is not available, falling back to the default FULLTEXT parser", "error", err)
+
+	if _, err := db.Exec("CREATE FULLTEXT INDEX ft_content ON messages (content)"); err != nil {
+		slog.Warn("FULLTEXT index is not available, use SEARCH_BACKEND=like", "error", err)
+	}
+	return nil
+}
+
+// Migrate applies all pending schema migrations
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at DATETIME NOT NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		// DDLは暗黙的にコミットされるため、各ステートメントは冪等に書くこと
+		for _, stmt := range m.statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		if m.apply != nil {
+			if err := m.apply(db); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+
+		if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.version, m.name, time.Now()); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+
+		slog.Info("applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
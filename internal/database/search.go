@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Search backends (SEARCH_BACKEND)
+const (
+	SearchBackendFulltext = "fulltext"
+	SearchBackendLike     = "like"
+)
+
+// FulltextParser returns the parser of the FULLTEXT index ft_content on
+// messages.content: "ngram", "default", or "" when the index does not exist.
+// 情報スキーマにはパーサが含まれないため SHOW CREATE TABLE から読み取る
+func FulltextParser(db *sql.DB) (string, error) {
+	var table, ddl string
+	if err := db.QueryRow("SHOW CREATE TABLE messages").Scan(&table, &ddl); err != nil {
+		return "", fmt.Errorf("failed to read messages table definition: %w", err)
+	}
+
+	for _, line := range strings.Split(ddl, "\n") {
+		if !strings.Contains(line, "FULLTEXT") || !strings.Contains(line, "`ft_content`") {
+			continue
+		}
+		if strings.Contains(line, "ngram") {
+			return "ngram", nil
+		}
+		return "default", nil
+	}
+	return "", nil
+}
+
+// ResolveSearchBackend returns the search backend to use for the requested
+// one. fulltext は ngram パーサの ft_content がある場合のみ使い、それ以外は like に切り替える
+// （標準のパーサは日本語を単語に分割しないため、日本語の検索が何も返さなくなる）
+func ResolveSearchBackend(db *sql.DB, requested string) (string, error) {
+	if requested != SearchBackendFulltext {
+		return requested, nil
+	}
+
+	parser, err := FulltextParser(db)
+	if err != nil {
+		return "", err
+	}
+	if parser != "ngram" {
+		slog.Warn("FULLTEXT index with the ngram parser is not available, falling back to SEARCH_BACKEND=like", "parser", parser)
+		return SearchBackendLike, nil
+	}
+	return SearchBackendFulltext, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestResolveSearchBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		ddl  string
+		want string
+	}{
+		{"ngram", "CREATE TABLE `messages` (\n  `content` text NOT NULL,\n  FULLTEXT KEY `ft_content` (`content`) /*!50100 WITH PARSER `ngram` */ \n)", SearchBackendFulltext},
+		{"default parser", "CREATE TABLE `messages` (\n  `content` text NOT NULL,\n  FULLTEXT KEY `ft_content` (`content`)\n)", SearchBackendLike},
+		{"no index", "CREATE TABLE `messages` (\n  `content` text NOT NULL\n)", SearchBackendLike},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to open sqlmock database: %s", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery("SHOW CREATE TABLE messages").
+				WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("messages", tt.ddl))
+
+			got, err := ResolveSearchBackend(db, SearchBackendFulltext)
+			if err != nil {
+				t.Fatalf("ResolveSearchBackend failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// like を指定した場合はデータベースを参照しない
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+	if got, err := ResolveSearchBackend(db, SearchBackendLike); err != nil || got != SearchBackendLike {
+		t.Errorf("Expected like, got %s (%v)", got, err)
+	}
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// Audit actions
+const (
+	auditMessageCreate   = "message_create"
+	auditMessageDelete   = "message_delete"
+	auditMessageRestore  = "message_restore"
+	auditMessageApprove  = "message_approve"
+	auditMessageReject   = "message_reject"
+	auditMessageHide     = "message_hide"
+	auditBanCreate       = "ban_create"
+	auditBanDelete       = "ban_delete"
+	auditShadowBanCreate = "shadow_ban_create"
+	auditShadowBanDelete = "shadow_ban_delete"
+)
+
+// Audit actor types
+const (
+	actorIP     = "ip"
+	actorToken  = "token"
+	actorAdmin  = "admin"
+	actorSystem = "system"
+)
+
+// auditActor identifies who sent r: the admin name, the hashed client
+// token, or the IP address
+func auditActor(r *http.Request) (actorType, actorID string) {
+	if name := middleware.AdminName(r); name != "" {
+		return actorAdmin, name
+	}
+	if strings.TrimSpace(r.Header.Get(middleware.ClientTokenHeader)) != "" {
+		return actorToken, middleware.ClientKey(r)
+	}
+	return actorIP, middleware.ClientIP(r)
+}
+
+// audit records an action performed by the sender of r.
+// 監査ログの書き込みに失敗しても操作自体は完了しているため、ログのみ出力する
+func (h *Handler) audit(r *http.Request, action, targetID, reason string) {
+	actorType, actorID := auditActor(r)
+	h.recordAudit(r.Context(), middleware.Logger(r), actorType, actorID, middleware.ClientIP(r), action, targetID, reason)
+}
+
+// auditSystem records an action performed automatically by the server
+func (h *Handler) auditSystem(ctx context.Context, action, targetID, reason string) {
+	h.recordAudit(ctx, slog.Default(), actorSystem, actorSystem, "", action, targetID, reason)
+}
+
+func (h *Handler) recordAudit(ctx context.Context, logger *slog.Logger, actorType, actorID, actorIP, action, targetID, reason string) {
+	_, err := h.DB.ExecContext(ctx, "INSERT INTO audit_events (created_at, actor_type, actor_id, actor_ip, action, target_id, reason) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		time.Now(), actorType, actorID, nullIfEmpty(actorIP), action, nullIfEmpty(targetID), nullIfEmpty(reason))
+	if err != nil {
+		logger.Error("failed to record audit event", "action", action, "target_id", targetID, "actor_type", actorType, "actor_id", actorID, "error", err)
+	}
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ListAuditEvents handles GET /admin/audit
+// since / until（RFC 3339）と actor_type / actor_id で絞り込み、新しい順に返す
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	q := r.URL.Query()
+
+	var where []string
+	var args []interface{}
+
+	for _, filter := range []struct {
+		param string
+		op    string
+	}{
+		{"since", ">="},
+		{"until", "<"},
+	} {
+		v := q.Get(filter.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logger.Warn("bad request", "reason", "invalid "+filter.param, "value", v)
+			writeError(w, r, apierror.InvalidTimestamp, "parameter", filter.param)
+			return
+		}
+		where = append(where, "created_at "+filter.op+" ?")
+		args = append(args, t)
+	}
+
+	for _, column := range []string{"actor_type", "actor_id", "action"} {
+		if v := q.Get(column); v != "" {
+			where = append(where, column+" = ?")
+			args = append(args, v)
+		}
+	}
+
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			logger.Warn("bad request", "reason", "invalid limit", "value", v)
+			writeError(w, r, apierror.InvalidLimit, "max", maxPageLimit)
+			return
+		}
+		limit = n
+	}
+
+	// 監査ログは追記のみのため、id の降順がそのまま時系列の降順になる
+	if v := q.Get("cursor"); v != "" {
+		beforeID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			logger.Warn("bad request", "reason", "invalid cursor", "value", v)
+			writeError(w, r, apierror.InvalidCursor)
+			return
+		}
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+
+	query := "SELECT id, created_at, actor_type, actor_id, actor_ip, action, target_id, reason FROM audit_events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := h.DB.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	defer rows.Close()
+
+	page := model.AuditPage{Events: []model.AuditEvent{}}
+	for rows.Next() {
+		var event model.AuditEvent
+		var actorIP, targetID, reason sql.NullString
+		if err := rows.Scan(&event.ID, &event.CreatedAt, &event.ActorType, &event.ActorID, &actorIP, &event.Action, &targetID, &reason); err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+		if len(page.Events) == limit {
+			page.NextCursor = page.Events[len(page.Events)-1].ID
+			break
+		}
+		event.ActorIP = actorIP.String
+		if targetID.Valid {
+			event.TargetID = &targetID.String
+		}
+		if reason.Valid {
+			event.Reason = &reason.String
+		}
+		page.Events = append(page.Events, event)
+	}
+
+	logger.Info("returned audit events", "count", len(page.Events))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
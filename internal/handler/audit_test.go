@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestDeleteMessage_RecordsAudit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("UPDATE messages SET deleted_at = \\? WHERE id = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(sqlmock.AnyArg(), actorIP, "192.168.6.1", "192.168.6.1", auditMessageDelete, "9", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest("DELETE", "/messages/9", nil)
+	req.RemoteAddr = "192.168.6.1:12345"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRejectMessage_RecordsAdminNameAndReason(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AdminTokens: "alice:token-a, bob:token-b"}).SetupRouter()
+
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id, held_reason, status FROM messages WHERE id = \\?").WithArgs("3").
+		WillReturnRows(sqlmock.NewRows(moderatedColumns).
+			AddRow("3", "spam", time.Now(), nil, holdReasonNGWord, model.StatusPending))
+	mock.ExpectExec("UPDATE messages SET status = \\? WHERE id = \\? AND status = 'pending'").
+		WithArgs(model.StatusRejected, "3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(sqlmock.AnyArg(), actorAdmin, "bob", sqlmock.AnyArg(), auditMessageReject, "3", "advertising").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest("POST", "/admin/messages/3/reject", bytes.NewReader([]byte(`{"reason":"advertising"}`)))
+	req.Header.Set("Authorization", "Bearer token-b")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListAuditEvents_Filters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AdminToken: testAdminToken}).SetupRouter()
+
+	since := time.Date(2026, 1, 29, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM audit_events WHERE created_at >= \\? AND actor_type = \\? AND actor_id = \\? ORDER BY id DESC LIMIT \\?").
+		WithArgs(since, actorIP, "192.168.6.1", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "actor_type", "actor_id", "actor_ip", "action", "target_id", "reason"}).
+			AddRow("12", since.Add(time.Hour), actorIP, "192.168.6.1", "192.168.6.1", auditMessageDelete, "123", nil))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newAdminRequest("GET", "/admin/audit?since=2026-01-29T00:00:00Z&actor_type=ip&actor_id=192.168.6.1"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var page model.AuditPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Events) != 1 || page.Events[0].TargetID == nil || *page.Events[0].TargetID != "123" {
+		t.Errorf("Expected the delete of message 123, got %+v", page.Events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListAuditEvents_InvalidSince(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AdminToken: testAdminToken}).SetupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newAdminRequest("GET", "/admin/audit?since=yesterday"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
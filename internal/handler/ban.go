@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/ban"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// ListBans handles GET /admin/bans
+// 有効な（期限切れでない）禁止を返す
+func (h *Handler) ListBans(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	bans := h.Bans.Active()
+
+	logger.Info("returned bans", "count", len(bans))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// CreateBan handles POST /admin/bans
+// 同じ範囲がすでに禁止されている場合は理由と期限を上書きする
+func (h *Handler) CreateBan(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var req model.BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
+		return
+	}
+
+	if utf8.RuneCountInString(req.Reason) > maxModerationReasonLength {
+		logger.Warn("bad request", "reason", "reason too long")
+		writeError(w, r, apierror.ReasonTooLong, "max", maxModerationReasonLength)
+		return
+	}
+
+	now := time.Now()
+	b := model.Ban{
+		CIDR:      req.CIDR,
+		Reason:    req.Reason,
+		CreatedBy: middleware.AdminName(r),
+		CreatedAt: now,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if req.Duration != "" {
+		if req.ExpiresAt != nil {
+			logger.Warn("bad request", "reason", "both duration and expires_at")
+			writeError(w, r, apierror.ConflictingExpiry)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			logger.Warn("bad request", "reason", "invalid duration", "value", req.Duration)
+			writeError(w, r, apierror.InvalidDuration)
+			return
+		}
+		expiresAt := now.Add(d)
+		b.ExpiresAt = &expiresAt
+	}
+
+	if b.ExpiresAt != nil && !b.ExpiresAt.After(now) {
+		logger.Warn("bad request", "reason", "expires_at in the past")
+		writeError(w, r, apierror.ExpiryInPast)
+		return
+	}
+
+	b, err := h.Bans.Add(r.Context(), b)
+	if errors.Is(err, ban.ErrInvalidCIDR) {
+		logger.Warn("bad request", "reason", "invalid cidr", "value", req.CIDR)
+		writeError(w, r, apierror.InvalidCIDR)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	logger.Info("banned", "cidr", b.CIDR, "ban_id", b.ID)
+	h.audit(r, auditBanCreate, b.ID, banAuditReason(b))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// DeleteBan handles DELETE /admin/bans/{id}
+func (h *Handler) DeleteBan(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	removed, err := h.Bans.Remove(r.Context(), id)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if !removed {
+		logger.Warn("not found")
+		writeError(w, r, apierror.BanNotFound)
+		return
+	}
+
+	logger.Info("unbanned")
+	h.audit(r, auditBanDelete, id, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// banAuditReason records the range together with the reason, since the
+// ban row may later be overwritten or removed
+func banAuditReason(b model.Ban) string {
+	reason := b.CIDR
+	if b.Reason != "" {
+		reason += ": " + b.Reason
+	}
+	if runes := []rune(reason); len(runes) > maxModerationReasonLength {
+		reason = string(runes[:maxModerationReasonLength])
+	}
+	return reason
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestBannedIP_RejectedBeforeRateLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+	router := h.SetupRouter()
+
+	mock.ExpectExec("INSERT INTO ip_bans").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := h.Bans.Add(context.Background(), model.Ban{CIDR: "192.168.7.0/24", CreatedBy: "admin", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	requests := []*http.Request{
+		httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hi"}`))),
+		httptest.NewRequest("DELETE", "/messages/1", nil),
+		httptest.NewRequest("GET", "/ws", nil),
+	}
+	// バーストを超える回数送っても、レート制限ではなく禁止として拒否される
+	for i := 0; i < 10; i++ {
+		for _, req := range requests {
+			req.RemoteAddr = "192.168.7.20:12345"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("%s %s: expected status %d, got %d", req.Method, req.URL.Path, http.StatusForbidden, rr.Code)
+			}
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateBan_WithDuration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{AdminToken: testAdminToken})
+	router := h.SetupRouter()
+
+	mock.ExpectExec("INSERT INTO ip_bans").
+		WithArgs("203.0.113.5/32", "troll", "admin", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(sqlmock.AnyArg(), actorAdmin, "admin", sqlmock.AnyArg(), auditBanCreate, "3", "203.0.113.5/32: troll").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest("POST", "/admin/bans", bytes.NewReader([]byte(`{"cidr":"203.0.113.5","reason":"troll","duration":"24h"}`)))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var b model.Ban
+	if err := json.NewDecoder(rr.Body).Decode(&b); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if b.ExpiresAt == nil || b.ExpiresAt.Sub(time.Now()) < 23*time.Hour {
+		t.Errorf("Expected expiry about 24h from now, got %v", b.ExpiresAt)
+	}
+	if _, banned := h.Bans.Lookup("203.0.113.5"); !banned {
+		t.Error("Expected the ban to apply immediately")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateBan_InvalidCIDR(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AdminToken: testAdminToken}).SetupRouter()
+
+	req := httptest.NewRequest("POST", "/admin/bans", bytes.NewReader([]byte(`{"cidr":"example.com"}`)))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/captcha"
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+)
+
+// captchaTokenHeader carries the response token of the CAPTCHA widget
+const captchaTokenHeader = "X-Captcha-Token"
+
+// newCaptchaVerifier creates the verifier configured by CAPTCHA_VERIFY_URL,
+// or nil when CAPTCHA is disabled
+func newCaptchaVerifier(cfg config.Config) captcha.Verifier {
+	if cfg.CaptchaVerifyURL == "" {
+		return nil
+	}
+	return captcha.NewHTTPVerifier(cfg.CaptchaVerifyURL, cfg.CaptchaSecret, cfg.CaptchaTimeout)
+}
+
+// checkCaptcha verifies the X-Captcha-Token header when a verifier is
+// configured, writing a 400 (missing), 403 (rejected) or 503 (provider
+// unavailable with CAPTCHA_FAIL_OPEN=false) response.
+func (h *Handler) checkCaptcha(w http.ResponseWriter, r *http.Request) bool {
+	logger := middleware.Logger(r)
+	if h.Captcha == nil {
+		return true
+	}
+
+	token := strings.TrimSpace(r.Header.Get(captchaTokenHeader))
+	if token == "" {
+		logger.Warn("bad request", "reason", "missing captcha token")
+		writeError(w, r, apierror.CaptchaRequired)
+		return false
+	}
+
+	ok, err := h.Captcha.Verify(r.Context(), token, middleware.ClientIP(r))
+	if err != nil {
+		if h.Config.CaptchaFailOpen {
+			logger.Warn("captcha verification unavailable, accepting without it", "error", err)
+			return true
+		}
+		logger.Error("captcha verification unavailable", "error", err)
+		writeError(w, r, apierror.CaptchaUnavailable)
+		return false
+	}
+
+	if !ok {
+		logger.Warn("forbidden", "reason", "captcha verification failed")
+		writeError(w, r, apierror.CaptchaFailed)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+)
+
+// newCaptchaStub starts a siteverify stub accepting only the token "pass"
+func newCaptchaStub(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success": %t}`, r.FormValue("response") == "pass")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postWithCaptcha(router http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hello"}`)))
+	if token != "" {
+		req.Header.Set(captchaTokenHeader, token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateMessage_Captcha(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	server := newCaptchaStub(t)
+	router := New(db, config.Config{CaptchaVerifyURL: server.URL, CaptchaTimeout: time.Second}).SetupRouter()
+
+	if rr := postWithCaptcha(router, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := postWithCaptcha(router, "fail"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a rejected token, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	mock.ExpectExec("INSERT INTO messages").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	if rr := postWithCaptcha(router, "pass"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for a valid token, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_CaptchaProviderDown(t *testing.T) {
+	server := newCaptchaStub(t)
+	url := server.URL
+	server.Close()
+
+	tests := []struct {
+		name     string
+		failOpen bool
+		want     int
+	}{
+		{"fail closed", false, http.StatusServiceUnavailable},
+		{"fail open", true, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to open sqlmock database: %s", err)
+			}
+			defer db.Close()
+
+			router := New(db, config.Config{CaptchaVerifyURL: url, CaptchaTimeout: time.Second, CaptchaFailOpen: tt.failOpen}).SetupRouter()
+
+			if tt.failOpen {
+				mock.ExpectExec("INSERT INTO messages").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			if rr := postWithCaptcha(router, "pass"); rr.Code != tt.want {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.want, rr.Code, rr.Body.String())
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCreateMessage_CaptchaAfterValidation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	verified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"success": false}`)
+	}))
+	defer server.Close()
+
+	router := New(db, config.Config{CaptchaVerifyURL: server.URL, CaptchaTimeout: time.Second}).SetupRouter()
+
+	// 内容が不正なリクエストは CAPTCHA を検証せずに 400 を返す（トークンを無駄にしない）
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":""}`)))
+	req.Header.Set(captchaTokenHeader, "pass")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	if verified != 0 {
+		t.Errorf("Expected no captcha verification, got %d", verified)
+	}
+
+	// CAPTCHA の失敗は Idempotency-Key に保存せず、新しいトークンで再試行できるようにする
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req = httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hello"}`)))
+	req.Header.Set(captchaTokenHeader, "stale")
+	req.Header.Set(idempotencyKeyHeader, "captcha-retry")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/pow"
+)
+
+// powSolutionHeader carries "<token>:<solution>" of a challenge issued by GET /challenge
+const powSolutionHeader = "X-PoW-Solution"
+
+// newChallengeIssuer creates the proof-of-work issuer signed with POW_SECRET.
+// 未設定の場合はランダムな鍵を使う（POW_ENABLED=true では起動時に POW_SECRET を必須にしている）
+func newChallengeIssuer(cfg config.Config) *pow.Issuer {
+	secret := []byte(cfg.PowSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return pow.NewIssuer(secret, cfg.PowTTL)
+}
+
+// challengeDifficulty returns the difficulty for the sender of r: PowDifficulty,
+// raised up to PowMaxDifficulty as the client uses up its rate-limit burst
+func (h *Handler) challengeDifficulty(r *http.Request) int {
+	base, max := h.Config.PowDifficulty, h.Config.PowMaxDifficulty
+	if max < base {
+		max = base
+	}
+	return base + int(math.Ceil(h.RateLimiter.Pressure(r)*float64(max-base)))
+}
+
+// GetChallenge handles GET /challenge
+func (h *Handler) GetChallenge(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	if !h.Config.PowEnabled {
+		logger.Warn("not found", "reason", "proof of work is disabled")
+		writeError(w, r, apierror.PowDisabled)
+		return
+	}
+
+	challenge, err := h.Challenges.Issue(middleware.ClientKey(r), h.challengeDifficulty(r))
+	if err != nil {
+		logger.Error("failed to issue challenge", "error", err)
+		writeError(w, r, apierror.InternalError)
+		return
+	}
+
+	logger.Info("issued challenge", "difficulty", challenge.Difficulty)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// checkProofOfWork verifies the X-PoW-Solution header when PoW is enabled,
+// writing a 428 (missing) or 403 (invalid) response.
+func (h *Handler) checkProofOfWork(w http.ResponseWriter, r *http.Request) bool {
+	logger := middleware.Logger(r)
+	if !h.Config.PowEnabled {
+		return true
+	}
+
+	header := strings.TrimSpace(r.Header.Get(powSolutionHeader))
+	if header == "" {
+		logger.Warn("precondition required", "reason", "missing proof of work")
+		writeError(w, r, apierror.PowRequired)
+		return false
+	}
+
+	token, solution, _ := strings.Cut(header, ":")
+	expiresAt, err := h.Challenges.Verify(token, solution, middleware.ClientKey(r))
+	if err != nil {
+		logger.Warn("forbidden", "error", err)
+		code := apierror.PowInvalid
+		if errors.Is(err, pow.ErrExpired) {
+			code = apierror.PowExpired
+		}
+		writeError(w, r, code)
+		return false
+	}
+
+	// 使用済みのチャレンジは期限までデータベースに記録し、すべてのインスタンスで再利用を拒否する
+	tokenSum := sha256.Sum256([]byte(token))
+	result, err := h.DB.ExecContext(r.Context(), "INSERT IGNORE INTO pow_used_challenges (token_hash, expires_at) VALUES (?, ?)",
+		hex.EncodeToString(tokenSum[:]), expiresAt)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return false
+	}
+	if recorded, err := result.RowsAffected(); err == nil && recorded == 0 {
+		logger.Warn("forbidden", "reason", "challenge has already been used")
+		writeError(w, r, apierror.PowExpired)
+		return false
+	}
+	return true
+}
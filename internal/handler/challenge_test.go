@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/pow"
+)
+
+func TestCreateMessage_ProofOfWork(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	h := New(db, config.Config{PowEnabled: true, PowSecret: "secret", PowDifficulty: 4, PowMaxDifficulty: 8, PowTTL: time.Minute})
+	router := h.SetupRouter()
+
+	post := func(solution string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hello"}`)))
+		req.RemoteAddr = "192.0.2.10:1234"
+		if solution != "" {
+			req.Header.Set(powSolutionHeader, solution)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(""); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected status %d without a solution, got %d", http.StatusPreconditionRequired, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/challenge", nil)
+	req.RemoteAddr = "192.0.2.10:1234"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var challenge pow.Challenge
+	if err := json.Unmarshal(rr.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	// 先ほどの POST でバケットを1つ消費したため、難易度が上がっている
+	if challenge.Difficulty <= 4 || challenge.Difficulty > 8 {
+		t.Errorf("Expected difficulty in (4, 8], got %d", challenge.Difficulty)
+	}
+
+	solution := challenge.Token + ":" + pow.Solve(challenge.Token, challenge.Difficulty)
+
+	mock.ExpectExec("INSERT IGNORE INTO pow_used_challenges").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO messages").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	if rr := post(solution); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d with a valid solution, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 解いたチャレンジは（他のインスタンスで使われた場合も）再利用できない
+	mock.ExpectExec("INSERT IGNORE INTO pow_used_challenges").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if rr := post(solution); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a reused solution, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetChallenge_Disabled(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	router := New(db, config.Config{}).SetupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/challenge", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestCreateMessage_ProofOfWorkAfterValidation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	router := New(db, config.Config{PowEnabled: true, PowSecret: "secret", PowDifficulty: 4, PowTTL: time.Minute}).SetupRouter()
+
+	// 内容が不正なリクエストは、解を検証する前に 400 で拒否する
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":""}`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetChallenge_RateLimited(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	router := New(db, config.Config{PowEnabled: true, PowSecret: "secret", PowDifficulty: 4, PowTTL: time.Minute}).SetupRouter()
+
+	// バースト（5）を超えると 429 になる
+	var rr *httptest.ResponseRecorder
+	for i := 0; i < 6; i++ {
+		req := httptest.NewRequest("GET", "/challenge", nil)
+		req.RemoteAddr = "192.0.2.11:1234"
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	}
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+}
+
+func TestGetChallenge_DifficultyPerIP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	h := New(db, config.Config{PowEnabled: true, PowSecret: "secret", PowDifficulty: 4, PowMaxDifficulty: 8, PowTTL: time.Minute})
+	router := h.SetupRouter()
+
+	// 1つ目の接続で POST のバケットを消費する
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hello"}`)))
+	req.RemoteAddr = "192.0.2.11:1111"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 同じIPアドレスからの新しい接続でも基本の難易度には戻らない
+	req = httptest.NewRequest("GET", "/challenge", nil)
+	req.RemoteAddr = "192.0.2.11:2222"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var challenge pow.Challenge
+	if err := json.Unmarshal(rr.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	if challenge.Difficulty <= 4 {
+		t.Errorf("Expected difficulty above 4 on a new connection, got %d", challenge.Difficulty)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
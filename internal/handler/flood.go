@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"context"
+	"time"
+)
+
+// Duplicate content actions (DUPLICATE_ACTION)
+const (
+	duplicateActionReject     = "reject"
+	duplicateActionQuarantine = "quarantine"
+)
+
+// countRecentDuplicates returns the number of messages posted within
+// DuplicateWindow whose normalized content has the given fingerprint, in
+// total and by the author authorKey.
+// 削除・保留済みのメッセージも含めて数える
+func (h *Handler) countRecentDuplicates(ctx context.Context, fingerprint, authorKey string, now time.Time) (total, byAuthor int, err error) {
+	err = h.DB.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(SUM(author_key = ?), 0) FROM messages WHERE fingerprint = ? AND created_at > ?",
+		authorKey, fingerprint, now.Add(-h.Config.DuplicateWindow)).Scan(&total, &byAuthor)
+	return total, byAuthor, err
+}
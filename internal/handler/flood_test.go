@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+	"fuwapachi/internal/textnorm"
+)
+
+// duplicateCountQuery は countRecentDuplicates のクエリ（全体と投稿者ごとの件数を返す）
+const duplicateCountQuery = "SELECT COUNT\\(\\*\\), COALESCE\\(SUM\\(author_key = \\?\\), 0\\) FROM messages WHERE fingerprint = \\? AND created_at > \\?"
+
+func newDuplicateRouter(t *testing.T, action string, globalThreshold int) (http.Handler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h := New(db, config.Config{
+		DuplicateThreshold:       3,
+		DuplicateGlobalThreshold: globalThreshold,
+		DuplicateWindow:          10 * time.Minute,
+		DuplicateAction:          action,
+	})
+	return h.SetupRouter(), mock
+}
+
+func newContentRequest(content string) *http.Request {
+	body, _ := json.Marshal(map[string]string{"content": content})
+	return httptest.NewRequest("POST", "/messages", bytes.NewReader(body))
+}
+
+func postContent(router http.Handler, content string) *httptest.ResponseRecorder {
+	req := newContentRequest(content)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateMessage_DuplicateBelowThreshold(t *testing.T) {
+	router, mock := newDuplicateRouter(t, duplicateActionReject, 0)
+	authorKey := middleware.IPKey(newContentRequest(""))
+
+	mock.ExpectQuery(duplicateCountQuery).
+		WithArgs(authorKey, textnorm.Fingerprint("ふわぱち"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "by_author"}).AddRow(2, 2))
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("ふわぱち", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), textnorm.Fingerprint("ふわぱち"), nil, model.StatusApproved, nil, nil, authorKey).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := postContent(router, "ふわぱち")
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_DuplicateRejected(t *testing.T) {
+	router, mock := newDuplicateRouter(t, duplicateActionReject, 0)
+
+	// 空白や全角・半角の違いは同一内容として数える
+	mock.ExpectQuery(duplicateCountQuery).
+		WithArgs(sqlmock.AnyArg(), textnorm.Fingerprint("ＳＰＡＭ spam"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "by_author"}).AddRow(3, 3))
+
+	rr := postContent(router, "ＳＰＡＭ spam")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusTooManyRequests, rr.Code, rr.Body.String())
+	}
+
+	var body apierror.Body
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Code != apierror.DuplicateContent || body.Details["reason"] != holdReasonDuplicate {
+		t.Errorf("Expected code %q with reason %q, got %+v", apierror.DuplicateContent, holdReasonDuplicate, body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_DuplicateQuarantined(t *testing.T) {
+	router, mock := newDuplicateRouter(t, duplicateActionQuarantine, 0)
+
+	mock.ExpectQuery(duplicateCountQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "by_author"}).AddRow(5, 5))
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("spam", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), holdReasonDuplicate, model.StatusPending, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	rr := postContent(router, "spam")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["held_reason"] != holdReasonDuplicate {
+		t.Errorf("Expected held_reason %q, got %v", holdReasonDuplicate, body["held_reason"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_DuplicateFromOtherClients(t *testing.T) {
+	// 他のクライアントが同じ内容を投稿していても、既定では拒否も保留もしない
+	router, mock := newDuplicateRouter(t, duplicateActionReject, 0)
+
+	mock.ExpectQuery(duplicateCountQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "by_author"}).AddRow(50, 0))
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("おはよう", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, model.StatusApproved, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(8, 1))
+
+	if rr := postContent(router, "おはよう"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// DUPLICATE_GLOBAL_THRESHOLD を設定した場合は承認待ちにする（拒否はしない）
+	router, mock = newDuplicateRouter(t, duplicateActionReject, 10)
+
+	mock.ExpectQuery(duplicateCountQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "by_author"}).AddRow(10, 0))
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("buy now", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), holdReasonDuplicate, model.StatusPending, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+
+	if rr := postContent(router, "buy now"); rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -2,14 +2,26 @@ package handler
 
 import (
 	"database/sql"
+	"log/slog"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/ban"
+	"fuwapachi/internal/broadcast"
+	"fuwapachi/internal/captcha"
 	"fuwapachi/internal/config"
+	"fuwapachi/internal/metrics"
 	"fuwapachi/internal/middleware"
 	"fuwapachi/internal/model"
+	"fuwapachi/internal/ngword"
+	"fuwapachi/internal/pow"
+	"fuwapachi/internal/tracing"
 )
 
 // Handler holds application dependencies
@@ -18,40 +30,165 @@ type Handler struct {
 	Config    config.Config
 	Clients   map[*websocket.Conn]bool
 	ClientMu  sync.RWMutex
-	Broadcast chan model.DeleteEventMessage
+	Broadcast chan model.Event
+	Backplane broadcast.Backplane
+	NGWords   *ngword.Filter
+	Bans      *ban.List
+	// ShadowBans はシャドウバンされたクライアントの一覧
+	ShadowBans *ban.ShadowList
+	// RateLimiter は POST / DELETE のレート制限（チャレンジの難易度にも使う）
+	RateLimiter *middleware.RateLimiter
+	// ChallengeLimiter は GET /challenge のレート制限（POST のバケットとは別に数える）
+	ChallengeLimiter *middleware.RateLimiter
+	// Challenges は GET /challenge で発行するプルーフ・オブ・ワークのチャレンジ
+	Challenges *pow.Issuer
+	// Captcha は POST /messages の CAPTCHA 検証（CAPTCHA_VERIFY_URL が空の場合は nil）
+	Captcha captcha.Verifier
+	// Metrics は GET /metrics で公開する Prometheus のメトリクス
+	Metrics *metrics.Metrics
+
+	localEvents     chan localDelivery
+	presenceChanged chan struct{}
+
+	// instanceID は他のインスタンスと接続数を区別するための識別子
+	instanceID string
+	// remoteOnline は他のインスタンスから届いた接続数
+	remoteOnline map[string]remotePresence
+	presenceMu   sync.Mutex
 }
 
 // New creates a new Handler with the given dependencies
 func New(db *sql.DB, cfg config.Config) *Handler {
-	return &Handler{
-		DB:        db,
-		Config:    cfg,
-		Clients:   make(map[*websocket.Conn]bool),
-		Broadcast: make(chan model.DeleteEventMessage, 100),
+	h := &Handler{
+		DB:         db,
+		Config:     cfg,
+		Clients:    make(map[*websocket.Conn]bool),
+		Broadcast:  make(chan model.Event, 100),
+		Backplane:  newBackplane(db, cfg),
+		NGWords:    newNGWordFilter(cfg),
+		Bans:       ban.NewList(db),
+		ShadowBans: ban.NewShadowList(db),
+
+		RateLimiter:      middleware.NewRateLimiter(),
+		ChallengeLimiter: middleware.NewRateLimiter(),
+		Challenges:       newChallengeIssuer(cfg),
+		Captcha:          newCaptchaVerifier(cfg),
+		Metrics:          metrics.New(),
+
+		localEvents:     make(chan localDelivery, 100),
+		presenceChanged: make(chan struct{}, 1),
+
+		instanceID:   newInstanceID(),
+		remoteOnline: make(map[string]remotePresence),
+	}
+	h.registerMetrics()
+	return h
+}
+
+// purgeInterval は期限切れの Idempotency-Key や使用済みチャレンジをまとめて削除する間隔
+const purgeInterval = 10 * time.Minute
+
+// PurgeExpired periodically deletes Idempotency-Keys older than IDEMPOTENCY_TTL
+// and used proof-of-work challenges that have expired.
+// リクエストごとには削除せず、期限切れの Idempotency-Key は予約が衝突したときにそのキーだけ削除する
+func (h *Handler) PurgeExpired() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if _, err := h.DB.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", now.Add(-h.idempotencyTTL())); err != nil {
+			slog.Error("failed to purge idempotency keys", "error", err)
+		}
+		if _, err := h.DB.Exec("DELETE FROM pow_used_challenges WHERE expires_at < ?", now); err != nil {
+			slog.Error("failed to purge used challenges", "error", err)
+		}
 	}
 }
 
+// newBackplane selects the broadcast backplane configured by BROADCAST_BACKEND
+func newBackplane(db *sql.DB, cfg config.Config) broadcast.Backplane {
+	if cfg.BroadcastBackend == "database" {
+		return broadcast.NewOutbox(db, cfg.BroadcastPollInterval, cfg.BroadcastRetention)
+	}
+	return broadcast.NewLocal(100)
+}
+
+// newNGWordFilter loads the word list configured by NGWORD_FILE.
+// 起動時に読み込めなくても、Watch で後から読み込まれる
+func newNGWordFilter(cfg config.Config) *ngword.Filter {
+	f := ngword.New(cfg.NGWordFile)
+	if err := f.Reload(); err != nil {
+		slog.Warn("failed to load NG word list", "error", err)
+	}
+	return f
+}
+
 // SetupRouter configures and returns the HTTP router
 func (h *Handler) SetupRouter() *mux.Router {
 	r := mux.NewRouter()
+	// 存在しないパスやメソッドも他のエラーと同じ JSON で返す。
+	// r.Use のミドルウェアはルートに一致したリクエストにしか適用されないため、メトリクスは個別に記録する（route="unknown"）
+	r.NotFoundHandler = h.Metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, apierror.NotFound)
+	}))
+	r.MethodNotAllowedHandler = h.Metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, apierror.MethodNotAllowed)
+	}))
+	// ハンドラーごとのスパン（名前はルートのテンプレート）。SQL のスパンはこの子になる
+	r.Use(otelmux.Middleware(tracing.ServiceName))
+	r.Use(h.Metrics.Instrument)
 
 	// REST API
 	r.HandleFunc("/messages", h.GetMessages).Methods("GET")
-	
+	r.HandleFunc("/messages/search", h.SearchMessages).Methods("GET")
+	r.HandleFunc("/messages/{id}", h.GetMessage).Methods("GET")
+	r.HandleFunc("/messages/{id}/thread", h.GetThread).Methods("GET")
+	r.HandleFunc("/stats/online", h.GetOnlineStats).Methods("GET")
+	// 難易度の低いうちにチャレンジを溜め込めないよう、発行も IP ごとに制限する
+	r.Handle("/challenge", h.ChallengeLimiter.Limit(1, 5)(http.HandlerFunc(h.GetChallenge))).Methods("GET")
+
 	// Create a subrouter for POST and DELETE to apply rate limiting (e.g. 1 req/sec, burst 5)
 	postRouter := r.Methods("POST").Subrouter()
-	postRouter.HandleFunc("/messages", h.CreateMessage)
-	
+	postRouter.HandleFunc("/messages", h.idempotent(h.CreateMessage))
+	postRouter.HandleFunc("/messages/{id}/reactions", h.CreateReaction)
+	postRouter.HandleFunc("/messages/{id}/reports", h.CreateReport)
+
 	deleteRouter := r.Methods("DELETE").Subrouter()
 	deleteRouter.HandleFunc("/messages/{id}", h.DeleteMessage)
-	
-	rl := middleware.NewRateLimiter()
+
+	// 禁止されたIPはレート制限より先に拒否する
+	rejectBanned := middleware.RejectBanned(h.Bans)
+	postRouter.Use(rejectBanned)
+	deleteRouter.Use(rejectBanned)
+
 	// limit to 1 request per second with a burst of 5 per IP
-	postRouter.Use(rl.Limit(1, 5))
-	deleteRouter.Use(rl.Limit(1, 5))
+	postRouter.Use(h.RateLimiter.Limit(1, 5))
+	deleteRouter.Use(h.RateLimiter.Limit(1, 5))
+
+	// 管理API（ADMIN_TOKEN による Bearer 認証）
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.HandleFunc("/messages", h.ListModerationQueue).Methods("GET")
+	adminRouter.HandleFunc("/messages/{id}/approve", h.ApproveMessage).Methods("POST")
+	adminRouter.HandleFunc("/messages/{id}/reject", h.RejectMessage).Methods("POST")
+	adminRouter.HandleFunc("/messages/{id}/restore", h.RestoreMessage).Methods("POST")
+	adminRouter.HandleFunc("/audit", h.ListAuditEvents).Methods("GET")
+	adminRouter.HandleFunc("/bans", h.ListBans).Methods("GET")
+	adminRouter.HandleFunc("/bans", h.CreateBan).Methods("POST")
+	adminRouter.HandleFunc("/bans/{id}", h.DeleteBan).Methods("DELETE")
+	adminRouter.HandleFunc("/shadow-bans", h.ListShadowBans).Methods("GET")
+	adminRouter.HandleFunc("/shadow-bans", h.CreateShadowBan).Methods("POST")
+	adminRouter.HandleFunc("/shadow-bans/{actor_type}/{actor_id}", h.DeleteShadowBan).Methods("DELETE")
+	requireAdmin := middleware.RequireAdmin(h.Config.AdminToken, h.Config.AdminTokens)
+	adminRouter.Use(requireAdmin)
+
+	// メトリクス（METRICS_ADDR を設定した場合は main が別のリスナーで公開する）
+	if h.Config.MetricsAddr == "" {
+		r.Handle("/metrics", requireAdmin(h.Metrics.Handler())).Methods("GET")
+	}
 
 	// WebSocket
-	r.HandleFunc("/ws", h.HandleWebSocket).Methods("GET")
+	r.Handle("/ws", rejectBanned(http.HandlerFunc(h.HandleWebSocket))).Methods("GET")
 
 	return r
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -16,7 +17,10 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/broadcast"
 	"fuwapachi/internal/config"
+	"fuwapachi/internal/database"
 	"fuwapachi/internal/model"
 )
 
@@ -57,17 +61,9 @@ func setupTestDB(t *testing.T) *sql.DB {
 		return nil
 	}
 
-	// AUTO_INCREMENT対応のテーブル作成
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS messages (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		content TEXT NOT NULL,
-		created_at DATETIME NOT NULL,
-		deleted_at DATETIME NULL
-	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
-	`
-	if _, err := testDB.Exec(createTableSQL); err != nil {
-		t.Fatalf("Failed to create test table: %v", err)
+	// スキーマを最新化（messages テーブルなどを作成）
+	if err := database.Migrate(testDB); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	// テストデータをクリア
@@ -88,14 +84,9 @@ func cleanupTestDB(testDB *sql.DB) {
 
 // newTestHandler テスト用のHandlerを生成
 func newTestHandler(testDB *sql.DB) *Handler {
-	return &Handler{
-		DB: testDB,
-		Config: config.Config{
-			AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
-		},
-		Clients:   make(map[*websocket.Conn]bool),
-		Broadcast: make(chan model.DeleteEventMessage, 100),
-	}
+	return New(testDB, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
+	})
 }
 
 // TestCreateMessage_Success メッセージ作成成功テスト
@@ -446,13 +437,9 @@ func TestDeleteMessage_NotFound(t *testing.T) {
 
 // TestWebSocketConnection WebSocket 接続テスト
 func TestWebSocketConnection(t *testing.T) {
-	h := &Handler{
-		Config: config.Config{
-			AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
-		},
-		Clients:   make(map[*websocket.Conn]bool),
-		Broadcast: make(chan model.DeleteEventMessage, 100),
-	}
+	h := New(nil, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
+	})
 
 	server := httptest.NewServer(h.SetupRouter())
 	defer server.Close()
@@ -485,15 +472,159 @@ func TestWebSocketConnection(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 }
 
+// TestHandleBroadcast_DeliversEvent Broadcast に送ったイベントがバックプレーン経由でクライアントに届くことを確認
+func TestHandleBroadcast_DeliversEvent(t *testing.T) {
+	h := New(nil, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080"},
+	})
+	go h.HandleBroadcast()
+	defer h.Backplane.Close()
+
+	server := httptest.NewServer(h.SetupRouter())
+	defer server.Close()
+
+	url := strings.Replace(server.URL, "http://", "ws://", 1)
+	header := http.Header{}
+	header.Set("Origin", "http://localhost:8080")
+
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/ws", header)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	// 登録されるまで待つ
+	for i := 0; i < 50; i++ {
+		h.ClientMu.RLock()
+		n := len(h.Clients)
+		h.ClientMu.RUnlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	h.Broadcast <- model.DeleteEventMessage{Type: "message_deleted", ID: "42", DeletedAt: time.Now()}
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event model.DeleteEventMessage
+	for event.Type == "" || event.Type == "presence" {
+		if err := ws.ReadJSON(&event); err != nil {
+			t.Fatalf("Failed to read broadcast event: %v", err)
+		}
+	}
+
+	if event.Type != "message_deleted" || event.ID != "42" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+// TestPresence_SentOnConnect 接続時に接続数イベントが届き、/stats/online に反映されることを確認
+func TestPresence_SentOnConnect(t *testing.T) {
+	h := New(nil, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080"},
+	})
+	go h.HandleBroadcast()
+	defer h.Backplane.Close()
+
+	server := httptest.NewServer(h.SetupRouter())
+	defer server.Close()
+
+	url := strings.Replace(server.URL, "http://", "ws://", 1)
+	header := http.Header{}
+	header.Set("Origin", "http://localhost:8080")
+
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/ws", header)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event model.PresenceEventMessage
+	if err := ws.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read presence event: %v", err)
+	}
+
+	if event.Type != "presence" || event.Online != 1 {
+		t.Errorf("Expected presence event with online=1, got %+v", event)
+	}
+
+	resp, err := http.Get(server.URL + "/stats/online")
+	if err != nil {
+		t.Fatalf("Failed to get /stats/online: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var stats model.OnlineStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	if stats.Online != 1 {
+		t.Errorf("Expected online=1, got %d", stats.Online)
+	}
+}
+
+// TestPresence_SumsInstances 他のインスタンスの接続数もバックプレーン経由で合計されることを確認
+func TestPresence_SumsInstances(t *testing.T) {
+	h := New(nil, config.Config{})
+	go h.HandleBroadcast()
+	defer h.Backplane.Close()
+
+	// 他のインスタンスが自分の接続数を送ったものとする
+	env, err := broadcast.Encode(model.PresenceCountEvent{Type: presenceCountType, Instance: "other", Online: 4})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := h.Backplane.Publish(context.Background(), env); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for h.onlineCount() != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected online=4, got %d", h.onlineCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 接続数が届かなくなったインスタンスは数えない
+	h.presenceMu.Lock()
+	h.remoteOnline["other"] = remotePresence{online: 4, seenAt: time.Now().Add(-presenceTTL - time.Second)}
+	h.presenceMu.Unlock()
+	if got := h.onlineCount(); got != 0 {
+		t.Errorf("Expected stale instance to be ignored, got online=%d", got)
+	}
+}
+
+// TestPresence_PublishesOnlyOnChange 接続数が変わらない限りバックプレーンに送らないことを確認
+func TestPresence_PublishesOnlyOnChange(t *testing.T) {
+	h := New(nil, config.Config{})
+	go h.runPresence()
+
+	h.notifyPresence()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.Broadcast) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first count to be published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 他のインスタンスの接続数が届いても、このインスタンスの接続数は変わらない
+	h.notifyPresence()
+	time.Sleep(100 * time.Millisecond)
+	if len(h.Broadcast) != 1 {
+		t.Errorf("Expected 1 published count, got %d", len(h.Broadcast))
+	}
+	if event, ok := (<-h.Broadcast).(model.PresenceCountEvent); !ok || event.Online != 0 {
+		t.Errorf("Unexpected presence count %+v", event)
+	}
+}
+
 // TestWebSocketOriginCheck Origin チェックテスト
 func TestWebSocketOriginCheck(t *testing.T) {
-	h := &Handler{
-		Config: config.Config{
-			AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
-		},
-		Clients:   make(map[*websocket.Conn]bool),
-		Broadcast: make(chan model.DeleteEventMessage, 100),
-	}
+	h := New(nil, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
+	})
 
 	server := httptest.NewServer(h.SetupRouter())
 	defer server.Close()
@@ -504,9 +635,46 @@ func TestWebSocketOriginCheck(t *testing.T) {
 	header := http.Header{}
 	header.Set("Origin", "http://forbidden.example.com")
 
-	_, _, err := websocket.DefaultDialer.Dial(url+"/ws", header)
+	_, resp, err := websocket.DefaultDialer.Dial(url+"/ws", header)
 	if err == nil {
-		t.Error("WebSocket connection from forbidden origin should fail")
+		t.Fatal("WebSocket connection from forbidden origin should fail")
+	}
+	defer resp.Body.Close()
+
+	// 拒否は他のエラーと同じ JSON で返す
+	var body apierror.Body
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden || body.Code != apierror.ForbiddenOrigin {
+		t.Errorf("Expected %d %q, got %d %+v", http.StatusForbidden, apierror.ForbiddenOrigin, resp.StatusCode, body)
+	}
+}
+
+// TestUnmatchedRoute 存在しないパスやメソッドへのリクエストも JSON のエラーを返すことを確認
+func TestUnmatchedRoute(t *testing.T) {
+	router := New(nil, config.Config{}).SetupRouter()
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         apierror.Code
+	}{
+		{"GET", "/nope", http.StatusNotFound, apierror.NotFound},
+		{"PUT", "/messages", http.StatusMethodNotAllowed, apierror.MethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+		var body apierror.Body
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", tt.method, tt.path, rr.Body.String(), err)
+		}
+		if rr.Code != tt.status || body.Code != tt.code {
+			t.Errorf("%s %s: expected %d %q, got %d %+v", tt.method, tt.path, tt.status, tt.code, rr.Code, body)
+		}
 	}
 }
 
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+)
+
+const (
+	// idempotencyKeyHeader は POST の再送を識別するためにクライアントが付与するヘッダー
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader は保存済みのレスポンスを再送したことを示すヘッダー
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength は Idempotency-Key の最大長
+	maxIdempotencyKeyLength = 255
+	// defaultIdempotencyTTL は IdempotencyTTL 未設定時の保存期間
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// responseCapture passes a response through while keeping a copy of its status and body
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (h *Handler) idempotencyTTL() time.Duration {
+	if h.Config.IdempotencyTTL > 0 {
+		return h.Config.IdempotencyTTL
+	}
+	return defaultIdempotencyTTL
+}
+
+// idempotencyKeyHash scopes an Idempotency-Key to the client that sent it,
+// so that clients choosing the same key never see each other's responses
+func idempotencyKeyHash(r *http.Request, key string) string {
+	sum := sha256.Sum256([]byte(middleware.ClientKey(r) + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotent wraps a POST handler so that requests repeated with the same
+// Idempotency-Key and body get the first response replayed instead of being
+// processed again. 同じキーで異なるボディが送られた場合は 422 を返す。
+// 保存するのは 2xx のレスポンスだけで、それ以外（検証エラー、レート制限、
+// CAPTCHA やプルーフ・オブ・ワークの失敗、サーバーエラーなど）はキーを解放し、
+// 同じキーでの再試行を許可する
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		logger := middleware.Logger(r)
+		if len(key) > maxIdempotencyKeyLength {
+			logger.Warn("bad request", "reason", "Idempotency-Key too long")
+			writeError(w, r, apierror.IdempotencyKeyTooLong, "max", maxIdempotencyKeyLength)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			logger.Warn("bad request", "error", err)
+			writeError(w, r, apierror.InvalidBody)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		keyHash := idempotencyKeyHash(r, key)
+		bodySum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(bodySum[:])
+
+		reserved, err := h.reserveIdempotencyKey(r, keyHash, requestHash)
+		if err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+		if !reserved {
+			h.replayIdempotent(w, r, keyHash, requestHash)
+			return
+		}
+
+		capture := &responseCapture{ResponseWriter: w}
+		defer func() {
+			// クライアントが切断してもキーが status = 0 のまま残らないよう、
+			// 保存と解放はリクエストのキャンセルに影響されないコンテキストで行う
+			ctx := context.WithoutCancel(r.Context())
+
+			// panic した場合も予約を残さず、同じキーでの再試行を許可する
+			v := recover()
+			if v == nil && capture.status >= 200 && capture.status < 300 {
+				if _, err := h.DB.ExecContext(ctx, "UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE key_hash = ?",
+					capture.status, capture.Header().Get("Content-Type"), capture.body.String(), keyHash); err != nil {
+					logger.Error("failed to store idempotent response", "error", err)
+				}
+				return
+			}
+
+			// 2xx 以外は保存せず、同じキーでの再試行を許可する
+			if _, err := h.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key_hash = ?", keyHash); err != nil {
+				logger.Error("failed to release Idempotency-Key", "error", err)
+			}
+			if v != nil {
+				panic(v)
+			}
+		}()
+		next(capture, r)
+	}
+}
+
+// reserveIdempotencyKey inserts a status = 0 row marking keyHash as in progress.
+// 既存のキーが期限切れの場合はそのキーだけ削除して予約し直す
+func (h *Handler) reserveIdempotencyKey(r *http.Request, keyHash, requestHash string) (bool, error) {
+	now := time.Now()
+	insert := func() (bool, error) {
+		result, err := h.DB.ExecContext(r.Context(), "INSERT IGNORE INTO idempotency_keys (key_hash, request_hash, status, body, created_at) VALUES (?, ?, 0, '', ?)",
+			keyHash, requestHash, now)
+		if err != nil {
+			return false, err
+		}
+		reserved, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return reserved > 0, nil
+	}
+
+	if reserved, err := insert(); err != nil || reserved {
+		return reserved, err
+	}
+
+	result, err := h.DB.ExecContext(r.Context(), "DELETE FROM idempotency_keys WHERE key_hash = ? AND created_at < ?",
+		keyHash, now.Add(-h.idempotencyTTL()))
+	if err != nil {
+		return false, err
+	}
+	expired, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if expired == 0 {
+		return false, nil
+	}
+	return insert()
+}
+
+// replayIdempotent writes the stored response for an Idempotency-Key that was already used
+func (h *Handler) replayIdempotent(w http.ResponseWriter, r *http.Request, keyHash, requestHash string) {
+	logger := middleware.Logger(r)
+	var storedHash, contentType, storedBody string
+	var status int
+	err := h.DB.QueryRowContext(r.Context(), "SELECT request_hash, status, content_type, body FROM idempotency_keys WHERE key_hash = ?", keyHash).
+		Scan(&storedHash, &status, &contentType, &storedBody)
+	if err == sql.ErrNoRows {
+		// 予約と参照の間に元のリクエストが失敗して解放された
+		logger.Warn("conflict", "reason", "Idempotency-Key released concurrently")
+		writeError(w, r, apierror.IdempotencyKeyReleased)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if storedHash != requestHash {
+		logger.Warn("unprocessable", "reason", "Idempotency-Key reused with a different body")
+		writeError(w, r, apierror.IdempotencyKeyMismatch)
+		return
+	}
+
+	if status == 0 {
+		logger.Warn("conflict", "reason", "original request still in progress")
+		writeError(w, r, apierror.IdempotencyInProgress)
+		return
+	}
+
+	logger.Info("replayed stored response", "status", status)
+
+	// 再送時の Accept に関わらず最初のレスポンスの表現をそのまま返すため、
+	// 保存した Content-Type を付ける
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(status)
+	io.WriteString(w, storedBody)
+}
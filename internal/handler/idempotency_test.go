@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+)
+
+func newIdempotentRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(body)))
+	req.RemoteAddr = "192.168.4.1:12345"
+	req.Header.Set(idempotencyKeyHeader, "b6f1c7a0-retry")
+	return req
+}
+
+func TestIdempotency_FirstRequestStoresResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WithArgs(idempotencyKeyHash(newIdempotentRequest(""), "b6f1c7a0-retry"), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO messages").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE idempotency_keys SET status = \\?, content_type = \\?, body = \\?").
+		WithArgs(http.StatusCreated, "application/json", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(`{"content":"retry me"}`))
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_ReplaysStoredResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	body := `{"content":"retry me"}`
+	sum := sha256.Sum256([]byte(body))
+	stored := `{"id":"1","content":"retry me","created_at":"2026-01-29T12:00:00Z"}`
+
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash, status, content_type, body FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "body"}).
+			AddRow(hex.EncodeToString(sum[:]), http.StatusCreated, "application/json", stored))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(body))
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected replayed status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if rr.Body.String() != stored {
+		t.Errorf("Expected stored body %s, got %s", stored, rr.Body.String())
+	}
+	if rr.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Error("Expected Idempotent-Replayed header")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_DifferentBody(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash, status, content_type, body FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "body"}).
+			AddRow("0000", http.StatusCreated, "application/json", "{}"))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(`{"content":"something else"}`))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestIdempotency_ExpiredKeyReserved(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	// 期限切れのキーはそのキーだけ削除して、新しいリクエストとして処理する
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO messages").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE idempotency_keys SET status = \\?, content_type = \\?, body = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(`{"content":"retry me"}`))
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_ClientErrorReleasesKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	// 4xx は保存せず、同じキーで修正したリクエストを送れるようにする
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(`{"content":""}`))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotencyKeyHash_ScopedByClient(t *testing.T) {
+	req := newIdempotentRequest("")
+	other := newIdempotentRequest("")
+	other.RemoteAddr = "192.168.4.2:12345"
+
+	if idempotencyKeyHash(req, "same-key") == idempotencyKeyHash(other, "same-key") {
+		t.Error("Expected different hashes for different clients")
+	}
+	if idempotencyKeyHash(req, "same-key") != idempotencyKeyHash(newIdempotentRequest(""), "same-key") {
+		t.Error("Expected the same hash for the same client")
+	}
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("Expected the panic to be re-raised, got %v", v)
+			}
+		}()
+		handler(httptest.NewRecorder(), newIdempotentRequest(`{"content":"retry me"}`))
+	}()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_ClientDisconnectStoresResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+
+	body := `{"content":"retry me"}`
+	sum := sha256.Sum256([]byte(body))
+	stored := `{"id":"1","content":"retry me","created_at":"2026-01-29T12:00:00Z"}`
+
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE idempotency_keys SET status = \\?, content_type = \\?, body = \\?").
+		WithArgs(http.StatusCreated, "application/json", stored, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// メッセージを保存した後にクライアントが切断しても、レスポンスは保存する
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, stored)
+	})
+	handler(httptest.NewRecorder(), newIdempotentRequest(body).WithContext(ctx))
+
+	// 同じキーでの再試行には 409 ではなく保存したレスポンスを返す
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash, status, content_type, body FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "body"}).
+			AddRow(hex.EncodeToString(sum[:]), http.StatusCreated, "application/json", stored))
+
+	rr := httptest.NewRecorder()
+	handler = h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the retry not to be processed again")
+	})
+	handler(rr, newIdempotentRequest(body))
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != stored {
+		t.Errorf("Expected the stored response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_RowsAffectedError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	// 予約できたか判定できない場合は処理を進めずに 500 を返す
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewErrorResult(errors.New("rows affected unavailable")))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(`{"content":"retry me"}`))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusInternalServerError, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotency_ReplaysStoredContentType(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	body := `{"content":"<b>raw</b>"}`
+	sum := sha256.Sum256([]byte(body))
+	stored := `{"id":"1","content":"<b>raw</b>","created_at":"2026-01-29T12:00:00Z"}`
+
+	// 最初のリクエストは生テキストの表現を要求し、その Content-Type を保存する
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO messages").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE idempotency_keys SET status = \\?, content_type = \\?, body = \\?").
+		WithArgs(http.StatusCreated, contentTypeTextJSON, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := newIdempotentRequest(body)
+	req.Header.Set("Accept", contentTypeTextJSON)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// Accept を変えて再送しても、エスケープされていないボディを application/json として返さない
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash, status, content_type, body FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "body"}).
+			AddRow(hex.EncodeToString(sum[:]), http.StatusCreated, contentTypeTextJSON, stored))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newIdempotentRequest(body))
+
+	if got := rr.Header().Get("Content-Type"); got != contentTypeTextJSON {
+		t.Errorf("Expected Content-Type %s, got %s", contentTypeTextJSON, got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %q", got)
+	}
+	if rr.Body.String() != stored {
+		t.Errorf("Expected stored body %s, got %s", stored, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
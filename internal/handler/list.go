@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+const (
+	// defaultPageLimit は limit 未指定時の1ページあたりの件数
+	defaultPageLimit = 20
+	// maxPageLimit は limit の上限
+	maxPageLimit = 100
+)
+
+// pageCursor is the decoded form of the opaque cursor of GET /messages?order=...
+// 直前のページの最後の (created_at, id) を保持する
+type pageCursor struct {
+	order     string
+	createdAt time.Time
+	id        int64
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func (c pageCursor) encode() string {
+	raw := fmt.Sprintf("%s|%d|%d", c.order, c.createdAt.UnixNano(), c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return pageCursor{}, errInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+
+	return pageCursor{order: parts[0], createdAt: time.Unix(0, nanos).UTC(), id: id}, nil
+}
+
+// listMessages handles GET /messages?order=newest|oldest
+// (created_at, id) のキーセットページネーションで時系列順に返す
+func (h *Handler) listMessages(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	q := r.URL.Query()
+
+	order := q.Get("order")
+	if order != "newest" && order != "oldest" {
+		logger.Warn("bad request", "reason", "invalid order", "value", order)
+		writeError(w, r, apierror.InvalidOrder)
+		return
+	}
+
+	visible, args := h.visibleTo(r)
+	where := []string{visible}
+
+	for _, filter := range []struct {
+		param string
+		op    string
+	}{
+		{"before", "<"},
+		{"after", ">"},
+	} {
+		v := q.Get(filter.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logger.Warn("bad request", "reason", "invalid "+filter.param, "value", v)
+			writeError(w, r, apierror.InvalidTimestamp, "parameter", filter.param)
+			return
+		}
+		where = append(where, "created_at "+filter.op+" ?")
+		args = append(args, t)
+	}
+
+	h.writeMessagePage(w, r, order, where, args)
+}
+
+// writeMessagePage runs a keyset-paginated query over live messages matching
+// where/args and writes a MessagePage. limit と cursor はリクエストから読み取る
+func (h *Handler) writeMessagePage(w http.ResponseWriter, r *http.Request, order string, where []string, args []interface{}) {
+	logger := middleware.Logger(r)
+	q := r.URL.Query()
+
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			logger.Warn("bad request", "reason", "invalid limit", "value", v)
+			writeError(w, r, apierror.InvalidLimit, "max", maxPageLimit)
+			return
+		}
+		limit = n
+	}
+
+	cmp, direction := "<", "DESC"
+	if order == "oldest" {
+		cmp, direction = ">", "ASC"
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil || cursor.order != order {
+			logger.Warn("bad request", "reason", "invalid cursor")
+			writeError(w, r, apierror.InvalidCursor)
+			return
+		}
+		where = append(where, fmt.Sprintf("(created_at %s ? OR (created_at = ? AND id %s ?))", cmp, cmp))
+		args = append(args, cursor.createdAt, cursor.createdAt, cursor.id)
+	}
+
+	// 次ページの有無を判定するため1件多く取得する
+	query := fmt.Sprintf("SELECT id, content, created_at, parent_id FROM messages WHERE %s ORDER BY created_at %s, id %s LIMIT ?",
+		strings.Join(where, " AND "), direction, direction)
+	args = append(args, limit+1)
+
+	rows, err := h.DB.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	defer rows.Close()
+
+	page := model.MessagePage{Messages: []model.Message{}}
+	var lastID int64
+	for rows.Next() {
+		var msg model.Message
+		var id int64
+		var parentID sql.NullString
+		if err := rows.Scan(&id, &msg.Content, &msg.CreatedAt, &parentID); err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+		if len(page.Messages) == limit {
+			// limit+1 件目が存在する = 次のページがある
+			last := page.Messages[len(page.Messages)-1]
+			page.NextCursor = pageCursor{order: order, createdAt: last.CreatedAt, id: lastID}.encode()
+			break
+		}
+		msg.ID = strconv.FormatInt(id, 10)
+		if parentID.Valid {
+			msg.ParentID = &parentID.String
+		}
+		page.Messages = append(page.Messages, msg)
+		lastID = id
+	}
+
+	ids := make([]string, len(page.Messages))
+	for i := range page.Messages {
+		ids[i] = page.Messages[i].ID
+	}
+	counts, err := h.reactionCounts(r.Context(), ids)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	for i := range page.Messages {
+		page.Messages[i].Reactions = counts[page.Messages[i].ID]
+	}
+
+	logger.Info("returned messages", "count", len(page.Messages), "order", order)
+
+	writeMessageJSON(w, r, http.StatusOK, page)
+}
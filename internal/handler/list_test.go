@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestListMessages_CursorPagination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}}).SetupRouter()
+
+	base := time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)
+
+	// 1ページ目: limit=2 に対して3件返る → next_cursor あり
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id FROM messages WHERE deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL ORDER BY created_at DESC, id DESC LIMIT \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).
+			AddRow(5, "five", base.Add(3*time.Second), nil).
+			AddRow(4, "four", base.Add(2*time.Second), nil).
+			AddRow(3, "three", base.Add(2*time.Second), nil))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").WithArgs("5", "4").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	req := httptest.NewRequest("GET", "/messages?order=newest&limit=2", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var page model.MessagePage
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Messages) != 2 || page.Messages[0].ID != "5" || page.Messages[1].ID != "4" {
+		t.Fatalf("Unexpected first page: %+v", page.Messages)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("Expected next_cursor on first page")
+	}
+
+	// 2ページ目: cursor の (created_at, id) より古いものを取得
+	mock.ExpectQuery("WHERE deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL AND \\(created_at < \\? OR \\(created_at = \\? AND id < \\?\\)\\) ORDER BY created_at DESC, id DESC").
+		WithArgs(base.Add(2*time.Second), base.Add(2*time.Second), int64(4), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).
+			AddRow(3, "three", base.Add(2*time.Second), nil))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	req = httptest.NewRequest("GET", "/messages?order=newest&limit=2&cursor="+page.NextCursor, nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	page = model.MessagePage{}
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Messages) != 1 || page.Messages[0].ID != "3" {
+		t.Fatalf("Unexpected second page: %+v", page.Messages)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("Expected no next_cursor on last page, got %q", page.NextCursor)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListMessages_InvalidParams(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}}).SetupRouter()
+
+	oldestCursor := pageCursor{order: "oldest", createdAt: time.Now(), id: 1}.encode()
+
+	for _, query := range []string{
+		"order=random",
+		"order=newest&limit=0",
+		"order=newest&limit=101",
+		"order=newest&before=yesterday",
+		"order=newest&cursor=not-a-cursor",
+		"order=newest&cursor=" + oldestCursor,
+	} {
+		req := httptest.NewRequest("GET", "/messages?"+query, nil)
+		req.Header.Set("Origin", "http://localhost:8080")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
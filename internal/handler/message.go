@@ -1,95 +1,232 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"html"
-	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
 	"fuwapachi/internal/model"
+	"fuwapachi/internal/ngword"
+	"fuwapachi/internal/textnorm"
 )
 
 // CreateMessage handles POST /messages
 func (h *Handler) CreateMessage(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[POST /messages] Request received from %s", r.RemoteAddr)
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
 
 	// リクエストボディサイズを1MBに制限
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 
 	var msg model.Message
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		log.Printf("[POST /messages] ❌ Bad Request: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
 		return
 	}
 
 	// Content is required for message creation
 	if msg.Content == "" {
-		log.Printf("[POST /messages] ❌ Bad Request: missing or empty content")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "content is required"})
+		logger.Warn("bad request", "reason", "missing or empty content")
+		writeError(w, r, apierror.ContentRequired)
 		return
 	}
 
 	// Validate content length (max 200 characters)
 	if utf8.RuneCountInString(msg.Content) > 200 {
-		log.Printf("[POST /messages] ❌ Bad Request: content too long")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "content must be 200 characters or less"})
+		logger.Warn("bad request", "reason", "content too long")
+		writeError(w, r, apierror.ContentTooLong, "max", 200)
 		return
 	}
 
-	// Escape HTML to prevent XSS
-	msg.Content = html.EscapeString(msg.Content)
+	// NGワードフィルター（正規化した内容で照合し、拒否・伏せ字・保留のいずれかを適用）
+	raw := msg.Content
+	filtered := h.NGWords.Check(msg.Content)
+	if filtered.Action == ngword.ActionReject {
+		logger.Warn("bad request", "reason", "content contains NG words")
+		writeError(w, r, apierror.ProhibitedContent, "reason", holdReasonNGWord)
+		return
+	}
+	msg.Content = filtered.Content
+
+	// 有効な場合は GET /challenge で取得したチャレンジの解と CAPTCHA を要求する。
+	// 解の検証と使用済みの記録、外部サービスでの CAPTCHA の検証は、データベースを使わない検証の後に行う
+	if !h.checkProofOfWork(w, r) {
+		return
+	}
+	if !h.checkCaptcha(w, r) {
+		return
+	}
+
+	// 返信の場合は親メッセージが存在し、送信者に表示されていることを確認
+	// （シャドウバンされたクライアントは自分の投稿にも返信できる）
+	if msg.ParentID != nil {
+		visible, visibleArgs := h.visibleTo(r)
+		var parentExists bool
+		err := h.DB.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND "+visible+")",
+			append([]interface{}{*msg.ParentID}, visibleArgs...)...).Scan(&parentExists)
+		if err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+
+		if !parentExists {
+			logger.Warn("bad request", "reason", "parent message not found", "parent_id", *msg.ParentID)
+			writeError(w, r, apierror.ParentNotFound)
+			return
+		}
+	}
 
 	// Set server-side controlled fields
 	msg.CreatedAt = time.Now()
 	msg.DeletedAt = nil
+	msg.Reactions = nil
+	msg.HeldReason = nil
+	if h.Config.ModerationPreApproval {
+		reason := holdReasonPreApproval
+		msg.HeldReason = &reason
+	}
+	if filtered.Action == ngword.ActionHold {
+		logger.Warn("holding content with NG words for review")
+		reason := holdReasonNGWord
+		msg.HeldReason = &reason
+	}
+
+	// 正規化した内容のハッシュで同一内容の連投を検知する。
+	// 伏せ字で内容が変わっても同じ投稿として数えるため、元の内容から計算する
+	fingerprint := textnorm.Fingerprint(raw)
+	authorKey := middleware.IPKey(r)
+	if h.Config.DuplicateThreshold > 0 || h.Config.DuplicateGlobalThreshold > 0 {
+		total, byAuthor, err := h.countRecentDuplicates(r.Context(), fingerprint, authorKey, msg.CreatedAt)
+		if err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+
+		quarantine := false
+		// 同じ投稿者による連投には DUPLICATE_ACTION を適用する
+		if h.Config.DuplicateThreshold > 0 && byAuthor >= h.Config.DuplicateThreshold {
+			if h.Config.DuplicateAction != duplicateActionQuarantine {
+				logger.Warn("rejected duplicate content", "count", byAuthor)
+				writeError(w, r, apierror.DuplicateContent, "reason", holdReasonDuplicate)
+				return
+			}
+			quarantine = true
+		}
+		// 投稿者をまたいだ同一内容は、無関係なクライアントを拒否しないよう承認待ちにするだけにする
+		if h.Config.DuplicateGlobalThreshold > 0 && total >= h.Config.DuplicateGlobalThreshold {
+			quarantine = true
+		}
+
+		if quarantine {
+			logger.Warn("quarantining duplicate content", "count", total, "by_author", byAuthor)
+			if msg.HeldReason == nil {
+				reason := holdReasonDuplicate
+				msg.HeldReason = &reason
+			}
+		}
+	}
+
+	// 保留されたメッセージはモデレーターの承認を待つ
+	msg.Status = model.StatusApproved
+	if msg.HeldReason != nil {
+		msg.Status = model.StatusPending
+	}
+
+	// シャドウバンされたクライアントの投稿は、通常どおり成功したように応答するが
+	// 投稿者本人にしか表示しない（ブロードキャストもしない）
+	storedStatus := msg.Status
+	var shadowKey, shadowTokenKey *string
+	if h.shadowBanned(r) {
+		logger.Warn("shadowing message from shadow-banned client")
+		storedStatus = model.StatusShadowed
+		// IPアドレスとトークンの両方を記録し、どちらか一方が変わっても本人には表示し続ける
+		ipKey := middleware.IPKey(r)
+		shadowKey = &ipKey
+		if key := tokenKey(r); key != "" {
+			shadowTokenKey = &key
+		}
+	}
 
 	// Insert message into database with AUTO_INCREMENT id
-	result, err := h.DB.Exec("INSERT INTO messages (content, created_at, deleted_at) VALUES (?, ?, ?)",
-		msg.Content, msg.CreatedAt, msg.DeletedAt)
+	result, err := h.DB.ExecContext(r.Context(), "INSERT INTO messages (content, created_at, deleted_at, parent_id, fingerprint, held_reason, status, shadow_key, shadow_token_key, author_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		msg.Content, msg.CreatedAt, msg.DeletedAt, msg.ParentID, fingerprint, msg.HeldReason, storedStatus, shadowKey, shadowTokenKey, authorKey)
 	if err != nil {
-		log.Printf("[POST /messages] ❌ Database error: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create message"})
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
 		return
 	}
 
 	// Get the auto-generated id
 	lastInsertID, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("[POST /messages] ❌ Database error: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve message id"})
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
 		return
 	}
 
 	msg.ID = fmt.Sprintf("%d", lastInsertID)
 
-	log.Printf("[POST /messages] ✅ Created message: ID=%s, Content=%q", msg.ID, msg.Content)
+	logger.Info("created message", "id", msg.ID, "content", msg.Content)
+	h.Metrics.MessagesCreated.WithLabelValues(storedStatus).Inc()
+
+	heldReason := ""
+	if msg.HeldReason != nil {
+		heldReason = *msg.HeldReason
+	}
+	if shadowKey != nil {
+		heldReason = auditReasonShadowBan
+	}
+	h.audit(r, auditMessageCreate, msg.ID, heldReason)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(msg)
+	// 承認待ちのメッセージは公開されないため 202 Accepted を返す
+	status := http.StatusCreated
+	if msg.Status == model.StatusPending {
+		status = http.StatusAccepted
+	}
+
+	writeMessageJSON(w, r, status, msg)
 }
 
-// maxMessagesPerRequest は1回のGETで返す最大レコード数
+// visibleCondition は一般のクライアントに公開されるメッセージの条件
+// （削除されておらず、承認済みで、通報により非表示にもなっていない）
+const visibleCondition = "deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL"
+
+// held_reason（作成時に保留された理由）
+const (
+	// holdReasonDuplicate は重複・連投検知による保留
+	holdReasonDuplicate = "duplicate_content"
+	// holdReasonNGWord は NG ワード（hold ルール）による保留
+	holdReasonNGWord = "ng_word"
+	// holdReasonPreApproval は事前承認モード（MODERATION_PRE_APPROVAL）による保留
+	holdReasonPreApproval = "pre_approval"
+)
+
+// maxMessagesPerRequest は count 未指定時に1回のGETで返す最大レコード数
 const maxMessagesPerRequest = 10
 
+// maxCount returns the upper bound of the count parameter of GET /messages
+func (h *Handler) maxCount() int {
+	if h.Config.MaxMessagesPerRequest > 0 {
+		return h.Config.MaxMessagesPerRequest
+	}
+	return maxMessagesPerRequest
+}
+
 func (h *Handler) isOriginAllowed(origin string) bool {
 	for _, allowed := range h.Config.AllowedOrigins {
 		if origin == allowed {
@@ -100,106 +237,113 @@ func (h *Handler) isOriginAllowed(origin string) bool {
 	return false
 }
 
-// GetMessages handles GET /messages
-// 削除されていないレコードからランダムに最大10件を返す
-func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[GET /messages] Request received from %s", r.RemoteAddr)
-
+// checkReadOrigin rejects read requests whose Origin (or Referer origin)
+// is not in ALLOWED_ORIGINS, writing a 403 response.
+func (h *Handler) checkReadOrigin(w http.ResponseWriter, r *http.Request) bool {
+	logger := middleware.Logger(r)
 	origin := r.Header.Get("Origin")
 	if origin != "" {
 		if !h.isOriginAllowed(origin) {
-			log.Printf("[GET /messages] ❌ Forbidden origin: %s", origin)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden"})
-			return
+			logger.Warn("forbidden origin", "origin", origin)
+			writeError(w, r, apierror.ForbiddenOrigin)
+			return false
 		}
 	} else {
 		referer := r.Referer()
 		if referer == "" {
-			log.Printf("[GET /messages] ❌ Missing Origin and Referer")
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden"})
-			return
+			logger.Warn("missing Origin and Referer")
+			writeError(w, r, apierror.ForbiddenOrigin)
+			return false
 		}
 
 		parsed, err := url.Parse(referer)
 		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
-			log.Printf("[GET /messages] ❌ Invalid Referer: %s", referer)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden"})
-			return
+			logger.Warn("invalid Referer", "referer", referer)
+			writeError(w, r, apierror.ForbiddenOrigin)
+			return false
 		}
 
 		refererOrigin := fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
 		if !h.isOriginAllowed(refererOrigin) {
-			log.Printf("[GET /messages] ❌ Forbidden referer origin: %s", refererOrigin)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Forbidden"})
+			logger.Warn("forbidden referer origin", "origin", refererOrigin)
+			writeError(w, r, apierror.ForbiddenOrigin)
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetMessages handles GET /messages
+// 削除されていないレコードからランダムに最大 count 件（デフォルト10件）を返す。
+// exclude / seen で指定されたIDは、他に候補がない場合にのみ返す
+// order を指定した場合は listMessages による時系列のページネーションになる
+func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	if !h.checkReadOrigin(w, r) {
+		return
+	}
+
+	// order が指定された場合は時系列のページネーション
+	if r.URL.Query().Get("order") != "" {
+		h.listMessages(w, r)
+		return
+	}
+
+	count := maxMessagesPerRequest
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > h.maxCount() {
+			logger.Warn("bad request", "reason", "invalid count", "value", v)
+			writeError(w, r, apierror.InvalidCount, "max", h.maxCount())
 			return
 		}
+		count = n
+	}
+
+	exclude, err := parseExclusions(r.URL.Query())
+	if err != nil {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidExclusion)
+		return
 	}
 
 	// 1. 最大IDを取得
 	var maxID int
-	err := h.DB.QueryRow("SELECT COALESCE(MAX(id), 0) FROM messages").Scan(&maxID)
+	err = h.DB.QueryRowContext(r.Context(), "SELECT COALESCE(MAX(id), 0) FROM messages").Scan(&maxID)
 	if err != nil {
-		log.Printf("[GET /messages] ❌ Database error: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
 		return
 	}
 
 	var msgList []model.Message
 
 	if maxID > 0 {
-		// 2. 1〜maxIDの範囲でランダムなIDを多め（例: 50個）に生成する
-		// 削除済みのギャップを考慮して多めに生成し、LIMIT 10で絞る
-		numToGenerate := 50
-		if maxID < 50 {
-			numToGenerate = maxID
-		}
-		
-		selectedIDs := make(map[int]bool)
-		var args []interface{}
-		inClause := ""
-		
-		for len(selectedIDs) < numToGenerate {
-			randID := rand.Intn(maxID) + 1
-			if !selectedIDs[randID] {
-				selectedIDs[randID] = true
-				if len(args) > 0 {
-					inClause += ", "
-				}
-				inClause += "?"
-				args = append(args, randID)
-			}
-		}
-
-		// 3. ランダム生成したID群から、未削除のものを最大10件取得
-		query := fmt.Sprintf("SELECT id, content, created_at FROM messages WHERE id IN (%s) AND deleted_at IS NULL LIMIT ?", inClause)
-		args = append(args, maxMessagesPerRequest)
+		// 2. 1〜maxIDの範囲で、クライアントが表示済みでないIDを要求件数より多めに生成する
+		// 削除済みのギャップを考慮して多めに生成し、LIMIT count で絞る
+		candidates := randomCandidates(maxID, count*candidateFactor, exclude)
+		visible, visibleArgs := h.visibleTo(r)
 
-		rows, err := h.DB.Query(query, args...)
+		// 3. ランダム生成したID群から、未削除のものを最大 count 件取得
+		msgList, err = h.sampleMessages(r.Context(), candidates, count, visible, visibleArgs)
 		if err != nil {
-			log.Printf("[GET /messages] ❌ Database error: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
 			return
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var msg model.Message
-			if err := rows.Scan(&msg.ID, &msg.Content, &msg.CreatedAt); err != nil {
-				continue
+		// 4. 足りない場合は表示済みのメッセージで補う
+		if len(msgList) < count && len(exclude) > 0 {
+			seen, err := h.sampleMessages(r.Context(), shuffledExclusions(maxID, exclude), count-len(msgList), visible, visibleArgs)
+			if err != nil {
+				logger.Error("database error", "error", err)
+				writeError(w, r, apierror.DatabaseError)
+				return
 			}
-			msgList = append(msgList, msg)
+			msgList = append(msgList, seen...)
 		}
 	}
 
@@ -207,56 +351,218 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		msgList = []model.Message{}
 	}
 
-	log.Printf("[GET /messages] ✅ Returned %d messages (random selection via MaxID)", len(msgList))
+	// リアクション件数を付与
+	ids := make([]string, len(msgList))
+	for i := range msgList {
+		ids[i] = msgList[i].ID
+	}
+	counts, err := h.reactionCounts(r.Context(), ids)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	for i := range msgList {
+		msgList[i].Reactions = counts[msgList[i].ID]
+	}
+
+	// 今回返したIDを加えた表示済みIDの集合を返し、次回の seen パラメータに使えるようにする
+	for _, msg := range msgList {
+		if id, err := strconv.Atoi(msg.ID); err == nil {
+			exclude[id] = true
+		}
+	}
+	w.Header().Set(seenTokenHeader, encodeSeenToken(exclude))
+
+	logger.Info("returned random messages", "count", len(msgList))
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(msgList)
+	writeMessageJSON(w, r, http.StatusOK, msgList)
 }
 
 // DeleteMessage handles DELETE /messages/{id}
 func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
 	id := mux.Vars(r)["id"]
-	log.Printf("[DELETE /messages/%s] Request received from %s", id, r.RemoteAddr)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
 
 	// Check if message exists and is not already deleted
 	var exists bool
-	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists)
+	err := h.DB.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists)
 	if err != nil {
-		log.Printf("[DELETE /messages/%s] ❌ Database error: %v", id, err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
 		return
 	}
 
 	if !exists {
-		log.Printf("[DELETE /messages/%s] ❌ Not Found", id)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Message not found"})
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
 		return
 	}
 
 	// Update deleted_at timestamp
 	now := time.Now()
-	_, err = h.DB.Exec("UPDATE messages SET deleted_at = ? WHERE id = ?", now, id)
+	_, err = h.DB.ExecContext(r.Context(), "UPDATE messages SET deleted_at = ? WHERE id = ?", now, id)
 	if err != nil {
-		log.Printf("[DELETE /messages/%s] ❌ Database error: %v", id, err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete message"})
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
 		return
 	}
 
-	log.Printf("[DELETE /messages/%s] ✅ Deleted successfully", id)
+	logger.Info("deleted message")
+	h.audit(r, auditMessageDelete, id, "")
+
+	deletedIDs := []string{id}
+
+	// 設定に応じて返信もまとめて削除する
+	if h.Config.ThreadDeleteCascade {
+		replyIDs, err := h.deleteReplies(r.Context(), id, now)
+		if err != nil {
+			// 親の削除は完了しているため、ログのみ出力して処理を続ける
+			logger.Error("failed to delete replies", "error", err)
+		} else if len(replyIDs) > 0 {
+			logger.Info("deleted replies", "count", len(replyIDs))
+		}
+		for _, replyID := range replyIDs {
+			h.audit(r, auditMessageDelete, replyID, "thread_cascade")
+		}
+		deletedIDs = append(deletedIDs, replyIDs...)
+	}
+
+	h.Metrics.MessagesDeleted.Add(float64(len(deletedIDs)))
+
+	// シャドウバンされた投稿の削除は通知しない
+	shadowed, err := h.shadowedIDs(r.Context(), deletedIDs)
+	if err != nil {
+		// 削除は完了しているため、ログのみ出力して通知を送らない
+		logger.Error("failed to check shadowed messages", "error", err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
 	// WebSocket経由で他のクライアントに削除を通知
-	h.Broadcast <- model.DeleteEventMessage{
-		Type:      "message_deleted",
-		ID:        id,
-		DeletedAt: now,
+	for _, deletedID := range deletedIDs {
+		if shadowed[deletedID] {
+			continue
+		}
+		h.Broadcast <- model.DeleteEventMessage{
+			Type:      "message_deleted",
+			ID:        deletedID,
+			DeletedAt: now,
+		}
+		logger.Info("broadcasting delete event", "id", deletedID)
 	}
-	log.Printf("[WebSocket] 📢 Broadcasting delete event for message: %s", id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GetMessage handles GET /messages/{id}
+// 削除済みのメッセージは 410 Gone を返す。ETag / Last-Modified による条件付きGETに対応
+func (h *Handler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	if !h.checkReadOrigin(w, r) {
+		return
+	}
+
+	var msg model.Message
+	var parentID sql.NullString
+	var deletedAt sql.NullTime
+	var visible bool
+	condition, args := h.visibleTo(r)
+	err := h.DB.QueryRowContext(r.Context(), "SELECT id, content, created_at, deleted_at, parent_id, ("+condition+") FROM messages WHERE id = ?", append(args, id)...).
+		Scan(&msg.ID, &msg.Content, &msg.CreatedAt, &deletedAt, &parentID, &visible)
+	// 保留中・非表示のメッセージは存在しないものとして扱う
+	if err == sql.ErrNoRows || (err == nil && !visible && !deletedAt.Valid) {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if deletedAt.Valid {
+		logger.Warn("gone", "deleted_at", deletedAt.Time.Format(time.RFC3339))
+		writeError(w, r, apierror.MessageDeleted, "id", msg.ID, "deleted_at", deletedAt.Time.Format(time.RFC3339))
+		return
+	}
+
+	if parentID.Valid {
+		msg.ParentID = &parentID.String
+	}
+
+	// リアクションが付くと表現が変わるため、最終更新日時はリアクションも考慮する
+	lastModified := msg.CreatedAt
+	var lastReaction sql.NullTime
+	err = h.DB.QueryRowContext(r.Context(), "SELECT MAX(created_at) FROM message_reactions WHERE message_id = ?", id).Scan(&lastReaction)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	if lastReaction.Valid && lastReaction.Time.After(lastModified) {
+		lastModified = lastReaction.Time
+	}
+
+	counts, err := h.reactionCounts(r.Context(), []string{msg.ID})
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	msg.Reactions = counts[msg.ID]
+
+	// 表現ごとに内容が異なるため、ETag も表現ごとに計算する
+	contentType := messageContentType(r)
+	body, err := json.Marshal(renderMessage(msg, contentType))
+	if err != nil {
+		logger.Error("failed to encode message", "error", err)
+		writeError(w, r, apierror.InternalError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if notModified(r, etag, lastModified) {
+		logger.Info("message not modified")
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	logger.Info("returned message")
+
+	writeMessageJSON(w, r, http.StatusOK, msg)
+}
+
+// notModified evaluates the conditional headers of a GET request against the
+// current ETag and Last-Modified of a representation (RFC 9110 13.2.2).
+// Range には対応しないため、If-None-Match / If-Modified-Since のみを評価する
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// 弱い比較（W/ の有無を無視する）
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP の日時は秒単位のため、秒未満を切り捨てて比較する
+	return !lastModified.Truncate(time.Second).After(ims)
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+// setupGetMessageRouter GET /messages/{id} 用のルーターとモックを生成
+func setupGetMessageRouter(t *testing.T) (*mux.Router, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}})
+	return h.SetupRouter(), mock
+}
+
+func expectLiveMessage(mock sqlmock.Sqlmock, createdAt time.Time) {
+	mock.ExpectQuery("SELECT id, content, created_at, deleted_at, parent_id, \\(.+\\) FROM messages WHERE id = \\?").WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "deleted_at", "parent_id", "visible"}).
+			AddRow("5", "hello", createdAt, nil, nil, true))
+	mock.ExpectQuery("SELECT MAX\\(created_at\\) FROM message_reactions").WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+}
+
+func TestGetMessage_ConditionalGet(t *testing.T) {
+	router, mock := setupGetMessageRouter(t)
+	createdAt := time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)
+
+	expectLiveMessage(mock, createdAt)
+	req := httptest.NewRequest("GET", "/messages/5", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag header")
+	}
+	if rr.Header().Get("Last-Modified") != createdAt.Format(http.TimeFormat) {
+		t.Errorf("Expected Last-Modified %s, got %s", createdAt.Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+	}
+
+	// 同じ ETag での再取得は 304
+	expectLiveMessage(mock, createdAt)
+	req = httptest.NewRequest("GET", "/messages/5", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for matching ETag, got %d", http.StatusNotModified, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetMessage_IfModifiedSinceAndRange(t *testing.T) {
+	router, mock := setupGetMessageRouter(t)
+	createdAt := time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)
+
+	// 変更がなければ If-Modified-Since でも 304
+	expectLiveMessage(mock, createdAt)
+	req := httptest.NewRequest("GET", "/messages/5", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.Header.Set("If-Modified-Since", createdAt.Format(http.TimeFormat))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for If-Modified-Since, got %d", http.StatusNotModified, rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected empty body for 304, got %q", rr.Body.String())
+	}
+
+	// Range は無視して JSON 全体を返す
+	expectLiveMessage(mock, createdAt)
+	req = httptest.NewRequest("GET", "/messages/5", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.Header.Set("Range", "bytes=0-5")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for Range request, got %d", http.StatusOK, rr.Code)
+	}
+	var msg model.Message
+	if err := json.Unmarshal(rr.Body.Bytes(), &msg); err != nil {
+		t.Fatalf("Expected the whole JSON body, got %q: %v", rr.Body.String(), err)
+	}
+	if msg.ID != "5" {
+		t.Errorf("Expected message 5, got %+v", msg)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetMessage_Deleted(t *testing.T) {
+	router, mock := setupGetMessageRouter(t)
+	deletedAt := time.Date(2026, 1, 29, 13, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT id, content, created_at, deleted_at, parent_id, \\(.+\\) FROM messages WHERE id = \\?").WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "deleted_at", "parent_id", "visible"}).
+			AddRow("5", "hello", deletedAt.Add(-time.Hour), deletedAt, nil, false))
+
+	req := httptest.NewRequest("GET", "/messages/5", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGone {
+		t.Fatalf("Expected status %d, got %d", http.StatusGone, rr.Code)
+	}
+
+	var errResp apierror.Body
+	json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if errResp.Code != apierror.MessageDeleted {
+		t.Errorf("Expected code %s, got %s", apierror.MessageDeleted, errResp.Code)
+	}
+	if errResp.Details["deleted_at"] != deletedAt.Format(time.RFC3339) {
+		t.Errorf("Expected deleted_at %s, got %v", deletedAt.Format(time.RFC3339), errResp.Details["deleted_at"])
+	}
+}
+
+func TestGetMessage_NotFound(t *testing.T) {
+	router, mock := setupGetMessageRouter(t)
+
+	mock.ExpectQuery("SELECT id, content, created_at, deleted_at, parent_id, \\(.+\\) FROM messages WHERE id = \\?").WithArgs("404").
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest("GET", "/messages/404", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// registerMetrics registers the gauges read from the state of h at scrape time
+func (h *Handler) registerMetrics() {
+	h.Metrics.GaugeFunc("websocket_clients", "Number of connected WebSocket clients.", func() float64 {
+		h.ClientMu.RLock()
+		defer h.ClientMu.RUnlock()
+		return float64(len(h.Clients))
+	})
+	h.Metrics.GaugeFunc("broadcast_queue_depth", "Number of events waiting in the broadcast queue.", func() float64 {
+		return float64(len(h.Broadcast))
+	})
+	h.Metrics.GaugeFunc("broadcast_queue_capacity", "Capacity of the broadcast queue.", func() float64 {
+		return float64(cap(h.Broadcast))
+	})
+	h.Metrics.CounterFunc("rate_limit_rejections_total", "Number of requests rejected by the rate limiter.", func() float64 {
+		return float64(h.RateLimiter.Rejections())
+	})
+
+	// sql.DB.Stats() の接続プールの統計（go_sql_* のメトリクス）
+	if h.DB != nil {
+		h.Metrics.Registry.MustRegister(collectors.NewDBStatsCollector(h.DB, "fuwapachi"))
+	}
+}
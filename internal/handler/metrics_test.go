@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestMetrics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	h := New(db, config.Config{AdminToken: "secret-token"})
+	router := h.SetupRouter()
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hello"}`)))
+		req.RemoteAddr = "192.0.2.20:1234"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	mock.ExpectExec("INSERT INTO messages").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	if rr := post(); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	// HandleBroadcast を起動していないため、イベントはキューに残る
+	h.Broadcast <- model.DeleteEventMessage{Type: "message_deleted", ID: "1"}
+
+	// バースト（5）を使い切るまでは本文が空のリクエストで消費し、6回目以降は 429 になる
+	for i := 0; i < 6; i++ {
+		req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":""}`)))
+		req.RemoteAddr = "192.0.2.20:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// メトリクスには管理APIと同じ Bearer トークンが必要
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d without a token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		`fuwapachi_http_requests_total{method="POST",route="/messages",status="201"} 1`,
+		`fuwapachi_http_requests_total{method="POST",route="/messages",status="400"} 4`,
+		`fuwapachi_http_requests_total{method="POST",route="/messages",status="429"} 2`,
+		`fuwapachi_http_request_duration_seconds_count{method="POST",route="/messages",status="201"} 1`,
+		`fuwapachi_messages_created_total{status="approved"} 1`,
+		`fuwapachi_rate_limit_rejections_total 2`,
+		`fuwapachi_websocket_clients 0`,
+		`fuwapachi_broadcast_queue_depth 1`,
+		`go_sql_open_connections{db_name="fuwapachi"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMetrics_SeparateListener(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	// METRICS_ADDR を設定した場合、メインのポートでは公開しない
+	router := New(db, config.Config{AdminToken: "secret-token", MetricsAddr: "127.0.0.1:9090"}).SetupRouter()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestMetrics_UnmatchedRoutes(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	router := New(db, config.Config{AdminToken: "secret-token"}).SetupRouter()
+
+	// スキャンなどによる 404 / 405 も数える
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/messages", nil))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		`fuwapachi_http_requests_total{method="GET",route="unknown",status="404"} 1`,
+		`fuwapachi_http_requests_total{method="PUT",route="unknown",status="405"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
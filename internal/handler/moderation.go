@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// ListModerationQueue handles GET /admin/messages?status=pending|approved|rejected
+// 削除されていないメッセージを古い順に返す（デフォルトは承認待ち）
+func (h *Handler) ListModerationQueue(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	q := r.URL.Query()
+
+	status := q.Get("status")
+	if status == "" {
+		status = model.StatusPending
+	}
+	if status != model.StatusPending && status != model.StatusApproved && status != model.StatusRejected && status != model.StatusShadowed {
+		logger.Warn("bad request", "reason", "invalid status", "value", status)
+		writeError(w, r, apierror.InvalidStatus)
+		return
+	}
+
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			logger.Warn("bad request", "reason", "invalid limit", "value", v)
+			writeError(w, r, apierror.InvalidLimit, "max", maxPageLimit)
+			return
+		}
+		limit = n
+	}
+
+	// キューは id 順に処理するため、cursor は直前のページの最後の id
+	var afterID int64
+	if v := q.Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			logger.Warn("bad request", "reason", "invalid cursor", "value", v)
+			writeError(w, r, apierror.InvalidCursor)
+			return
+		}
+		afterID = n
+	}
+
+	rows, err := h.DB.QueryContext(r.Context(), "SELECT id, content, created_at, parent_id, held_reason, status FROM messages WHERE status = ? AND deleted_at IS NULL AND id > ? ORDER BY id LIMIT ?",
+		status, afterID, limit+1)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	defer rows.Close()
+
+	page := model.MessagePage{Messages: []model.Message{}}
+	for rows.Next() {
+		msg, err := scanModeratedMessage(rows)
+		if err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+		if len(page.Messages) == limit {
+			page.NextCursor = page.Messages[len(page.Messages)-1].ID
+			break
+		}
+		page.Messages = append(page.Messages, msg)
+	}
+
+	logger.Info("returned moderation queue", "count", len(page.Messages), "status", status)
+
+	writeMessageJSON(w, r, http.StatusOK, page)
+}
+
+// maxModerationReasonLength は管理操作の理由の最大文字数
+const maxModerationReasonLength = 255
+
+// ApproveMessage handles POST /admin/messages/{id}/approve
+// 承認したメッセージを公開し、message_created イベントを通知する
+func (h *Handler) ApproveMessage(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, "approve", model.StatusApproved, auditMessageApprove)
+}
+
+// RejectMessage handles POST /admin/messages/{id}/reject
+func (h *Handler) RejectMessage(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, "reject", model.StatusRejected, auditMessageReject)
+}
+
+// moderate moves a pending message to status
+func (h *Handler) moderate(w http.ResponseWriter, r *http.Request, action, status, auditAction string) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	reason, ok := readModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	row := h.DB.QueryRowContext(r.Context(), "SELECT id, content, created_at, parent_id, held_reason, status FROM messages WHERE id = ? AND deleted_at IS NULL", id)
+	msg, err := scanModeratedMessage(row)
+	if err == sql.ErrNoRows {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if msg.Status != model.StatusPending {
+		logger.Warn("conflict", "reason", "message is "+msg.Status)
+		writeError(w, r, apierror.MessageNotPending)
+		return
+	}
+
+	// 承認されたメッセージは保留理由を消し、通常のメッセージと同じ扱いにする
+	query := "UPDATE messages SET status = ? WHERE id = ? AND status = 'pending'"
+	if status == model.StatusApproved {
+		query = "UPDATE messages SET status = ?, held_reason = NULL WHERE id = ? AND status = 'pending'"
+	}
+	result, err := h.DB.ExecContext(r.Context(), query, status, id)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	// 別のモデレーターが先に処理した場合
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		logger.Warn("conflict", "reason", "already moderated")
+		writeError(w, r, apierror.MessageNotPending)
+		return
+	}
+
+	msg.Status = status
+	if status == model.StatusApproved {
+		msg.HeldReason = nil
+	}
+
+	logger.Info("moderated message", "status", status)
+	h.audit(r, auditAction, id, reason)
+
+	if status == model.StatusApproved {
+		// WebSocket のイベントはブラウザ向けに HTML エスケープした内容を送る
+		published := renderMessage(msg, contentTypeJSON)
+		published.Status = ""
+		h.Broadcast <- model.CreateEventMessage{Type: "message_created", Message: published}
+		logger.Info("broadcasting create event", "id", id)
+	}
+
+	writeMessageJSON(w, r, http.StatusOK, msg)
+}
+
+// RestoreMessage handles POST /admin/messages/{id}/restore
+// 削除済み、または通報により非表示になったメッセージを元に戻す
+func (h *Handler) RestoreMessage(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	reason, ok := readModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	var restorable bool
+	row := h.DB.QueryRowContext(r.Context(), "SELECT id, content, created_at, parent_id, held_reason, status, (deleted_at IS NOT NULL OR hidden_at IS NOT NULL) FROM messages WHERE id = ?", id)
+	var msg model.Message
+	var parentID, heldReason sql.NullString
+	err := row.Scan(&msg.ID, &msg.Content, &msg.CreatedAt, &parentID, &heldReason, &msg.Status, &restorable)
+	if err == sql.ErrNoRows {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	if parentID.Valid {
+		msg.ParentID = &parentID.String
+	}
+	if heldReason.Valid {
+		msg.HeldReason = &heldReason.String
+	}
+
+	if !restorable {
+		logger.Warn("conflict", "reason", "message is neither deleted nor hidden")
+		writeError(w, r, apierror.MessageNotRemoved)
+		return
+	}
+
+	_, err = h.DB.ExecContext(r.Context(), "UPDATE messages SET deleted_at = NULL, hidden_at = NULL WHERE id = ?", id)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	// 以前の通報で再び非表示にならないよう、通報を取り消す
+	if _, err := h.DB.ExecContext(r.Context(), "DELETE FROM message_reports WHERE message_id = ?", id); err != nil {
+		logger.Error("failed to clear reports", "error", err)
+	}
+
+	logger.Info("restored message")
+	h.audit(r, auditMessageRestore, id, reason)
+
+	if msg.Status == model.StatusApproved {
+		// WebSocket のイベントはブラウザ向けに HTML エスケープした内容を送る
+		published := renderMessage(msg, contentTypeJSON)
+		published.Status = ""
+		h.Broadcast <- model.CreateEventMessage{Type: "message_created", Message: published}
+		logger.Info("broadcasting create event", "id", id)
+	}
+
+	writeMessageJSON(w, r, http.StatusOK, msg)
+}
+
+// readModerationReason reads the optional reason of an admin action,
+// writing a 400 response when the body is invalid
+func readModerationReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	logger := middleware.Logger(r)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var req model.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
+		return "", false
+	}
+
+	if utf8.RuneCountInString(req.Reason) > maxModerationReasonLength {
+		logger.Warn("bad request", "reason", "reason too long")
+		writeError(w, r, apierror.ReasonTooLong, "max", maxModerationReasonLength)
+		return "", false
+	}
+
+	return req.Reason, true
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanModeratedMessage scans id, content, created_at, parent_id, held_reason, status
+func scanModeratedMessage(row rowScanner) (model.Message, error) {
+	var msg model.Message
+	var parentID, heldReason sql.NullString
+	if err := row.Scan(&msg.ID, &msg.Content, &msg.CreatedAt, &parentID, &heldReason, &msg.Status); err != nil {
+		return model.Message{}, err
+	}
+	if parentID.Valid {
+		msg.ParentID = &parentID.String
+	}
+	if heldReason.Valid {
+		msg.HeldReason = &heldReason.String
+	}
+	return msg, nil
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+const testAdminToken = "test-admin-token"
+
+func newAdminRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+var moderatedColumns = []string{"id", "content", "created_at", "parent_id", "held_reason", "status"}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"disabled", "", "Bearer anything", http.StatusForbidden},
+		{"missing", testAdminToken, "", http.StatusUnauthorized},
+		{"wrong", testAdminToken, "Bearer wrong", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		router := New(db, config.Config{AdminToken: tt.token}).SetupRouter()
+		req := httptest.NewRequest("POST", "/admin/messages/1/approve", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestApproveMessage_Broadcasts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{AdminToken: testAdminToken})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id, held_reason, status FROM messages WHERE id = \\?").WithArgs("3").
+		WillReturnRows(sqlmock.NewRows(moderatedColumns).
+			AddRow("3", "hello", time.Now(), nil, holdReasonPreApproval, model.StatusPending))
+	mock.ExpectExec("UPDATE messages SET status = \\?, held_reason = NULL WHERE id = \\? AND status = 'pending'").
+		WithArgs(model.StatusApproved, "3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(sqlmock.AnyArg(), actorAdmin, "admin", sqlmock.AnyArg(), auditMessageApprove, "3", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newAdminRequest("POST", "/admin/messages/3/approve"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	select {
+	case event := <-h.Broadcast:
+		created, ok := event.(model.CreateEventMessage)
+		if !ok || created.Type != "message_created" || created.ID != "3" {
+			t.Errorf("Expected message_created event for 3, got %#v", event)
+		}
+	default:
+		t.Error("Expected message_created event to be broadcast")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRejectMessage_NotPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{AdminToken: testAdminToken})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id, held_reason, status FROM messages WHERE id = \\?").WithArgs("3").
+		WillReturnRows(sqlmock.NewRows(moderatedColumns).
+			AddRow("3", "hello", time.Now(), nil, nil, model.StatusApproved))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newAdminRequest("POST", "/admin/messages/3/reject"))
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+	if len(h.Broadcast) != 0 {
+		t.Error("Expected no event for a rejected request")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListModerationQueue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AdminToken: testAdminToken}).SetupRouter()
+
+	now := time.Now()
+	mock.ExpectQuery("FROM messages WHERE status = \\? AND deleted_at IS NULL AND id > \\? ORDER BY id LIMIT \\?").
+		WithArgs(model.StatusPending, int64(0), 2).
+		WillReturnRows(sqlmock.NewRows(moderatedColumns).
+			AddRow("4", "a", now, nil, holdReasonNGWord, model.StatusPending).
+			AddRow("6", "b", now, nil, holdReasonPreApproval, model.StatusPending))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newAdminRequest("GET", "/admin/messages?limit=1"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var page model.MessagePage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Messages) != 1 || page.NextCursor != "4" {
+		t.Errorf("Expected 1 message with next_cursor 4, got %d messages and %q", len(page.Messages), page.NextCursor)
+	}
+	if page.Messages[0].HeldReason == nil || *page.Messages[0].HeldReason != holdReasonNGWord {
+		t.Errorf("Expected held_reason %q, got %v", holdReasonNGWord, page.Messages[0].HeldReason)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_PreApproval(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{ModerationPreApproval: true}).SetupRouter()
+
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("hello", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), holdReasonPreApproval, model.StatusPending, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := postContent(router, "hello")
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
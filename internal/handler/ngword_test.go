@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func newNGWordRouter(t *testing.T) (http.Handler, sqlmock.Sqlmock) {
+	path := filepath.Join(t.TempDir(), "ngwords.txt")
+	if err := os.WriteFile(path, []byte("ばか mask\nspam hold\n死ね reject\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write word list: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return New(db, config.Config{NGWordFile: path}).SetupRouter(), mock
+}
+
+func TestCreateMessage_NGWordRejected(t *testing.T) {
+	router, mock := newNGWordRouter(t)
+
+	rr := postContent(router, "死 ね！")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_NGWordMasked(t *testing.T) {
+	router, mock := newNGWordRouter(t)
+
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("***** だね", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, model.StatusApproved, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := postContent(router, "ﾊﾞｶバカ だね")
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_NGWordHeld(t *testing.T) {
+	router, mock := newNGWordRouter(t)
+
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("ＳＰＡＭ", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), holdReasonNGWord, model.StatusPending, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := postContent(router, "ＳＰＡＭ")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["held_reason"] != holdReasonNGWord {
+		t.Errorf("Expected held_reason %q, got %v", holdReasonNGWord, body["held_reason"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"fuwapachi/internal/model"
+)
+
+// localDelivery is a payload written by HandleBroadcast to clients of this
+// instance only, bypassing the backplane
+type localDelivery struct {
+	// conn が nil の場合は全クライアントに送信する
+	conn    *websocket.Conn
+	payload []byte
+}
+
+const (
+	// presenceCountType は各インスタンスの接続数をバックプレーンで共有するイベントの種類
+	presenceCountType = "presence_count"
+	// presenceKeepAlive は接続数が変わらなくても自分の接続数を送り直す間隔。
+	// 接続数はバックプレーン（Outbox ではデータベース）に書き込まれるため、変わったときのほかは長い間隔でだけ送る
+	presenceKeepAlive = 10 * time.Minute
+	// presenceTTL を過ぎても接続数が届かないインスタンスは停止したものとみなす
+	presenceTTL = 3 * presenceKeepAlive
+)
+
+// remotePresence is the last online count received from another instance
+type remotePresence struct {
+	online int
+	seenAt time.Time
+}
+
+// newInstanceID returns a random identifier of this process
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// localOnlineCount returns the number of WebSocket clients connected to this instance
+func (h *Handler) localOnlineCount() int {
+	h.ClientMu.RLock()
+	defer h.ClientMu.RUnlock()
+	return len(h.Clients)
+}
+
+// onlineCount returns the number of WebSocket clients connected to all
+// instances: this instance's clients plus the counts published by the others
+func (h *Handler) onlineCount() int {
+	count := h.localOnlineCount()
+
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	now := time.Now()
+	for instance, p := range h.remoteOnline {
+		if now.Sub(p.seenAt) > presenceTTL {
+			delete(h.remoteOnline, instance)
+			continue
+		}
+		count += p.online
+	}
+	return count
+}
+
+// publishPresence shares the online count of this instance through the backplane
+func (h *Handler) publishPresence(online int) {
+	select {
+	case h.Broadcast <- model.PresenceCountEvent{Type: presenceCountType, Instance: h.instanceID, Online: online}:
+	default:
+		slog.Warn("broadcast queue full, dropping presence count")
+	}
+}
+
+// receivePresence records the online count published by another instance
+func (h *Handler) receivePresence(payload []byte) {
+	var event model.PresenceCountEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		slog.Error("failed to decode presence count", "error", err)
+		return
+	}
+	// 自分の接続数は Clients から直接数える
+	if event.Instance == h.instanceID {
+		return
+	}
+
+	h.presenceMu.Lock()
+	h.remoteOnline[event.Instance] = remotePresence{online: event.Online, seenAt: time.Now()}
+	h.presenceMu.Unlock()
+	h.notifyPresence()
+}
+
+// notifyPresence marks the online count as changed.
+// 送信は runPresence が PresenceInterval ごとに間引いて行う
+func (h *Handler) notifyPresence() {
+	select {
+	case h.presenceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// sendPresence queues the current online count for a single client
+func (h *Handler) sendPresence(conn *websocket.Conn) {
+	payload, err := json.Marshal(model.PresenceEventMessage{Type: "presence", Online: h.onlineCount()})
+	if err != nil {
+		return
+	}
+
+	select {
+	case h.localEvents <- localDelivery{conn: conn, payload: payload}:
+	default:
+		slog.Warn("local event queue full, dropping presence event")
+	}
+}
+
+// runPresence broadcasts the online count when it changes, at most once per
+// PresenceInterval, and publishes this instance's count to the other instances
+// when it changes and every presenceKeepAlive
+func (h *Handler) runPresence() {
+	var last time.Time
+	var pending <-chan time.Time
+	lastCount, lastLocal := -1, -1
+
+	keepAlive := time.NewTicker(presenceKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-keepAlive.C:
+			// 接続がない場合は期限切れになっても合計が変わらないため送らない
+			if local := h.localOnlineCount(); local > 0 {
+				h.publishPresence(local)
+			}
+
+		case <-h.presenceChanged:
+			if pending != nil {
+				continue
+			}
+			wait := h.Config.PresenceInterval - time.Since(last)
+			if wait < 0 {
+				wait = 0
+			}
+			pending = time.After(wait)
+
+		case <-pending:
+			pending = nil
+			if local := h.localOnlineCount(); local != lastLocal {
+				lastLocal = local
+				h.publishPresence(local)
+			}
+
+			count := h.onlineCount()
+			if count == lastCount {
+				continue
+			}
+			lastCount = count
+			last = time.Now()
+			h.sendPresence(nil)
+		}
+	}
+}
+
+// GetOnlineStats handles GET /stats/online
+func (h *Handler) GetOnlineStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.OnlineStats{Online: h.onlineCount()})
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// CreateReaction handles POST /messages/{id}/reactions
+// 同じIPアドレスからの同じ種別のリアクションは X-Client-Token に関係なく1回だけ数える
+func (h *Handler) CreateReaction(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var req model.ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
+		return
+	}
+
+	if !model.ReactionKinds[req.Kind] {
+		logger.Warn("bad request", "reason", "unknown kind", "value", req.Kind)
+		writeError(w, r, apierror.UnknownReaction)
+		return
+	}
+
+	// シャドウバンされたクライアントの投稿は本人にだけ存在するように見せる
+	visible, visibleArgs := h.visibleTo(r)
+	var exists bool
+	err := h.DB.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND "+visible+")",
+		append([]interface{}{id}, visibleArgs...)...).Scan(&exists)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if !exists {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+
+	// 主キー (message_id, kind, reactor_key) で重複を無視する。
+	// トークンを作り直して同じ種別のリアクションを何度も付けられないよう、reactor_key はIPアドレスから作る
+	result, err := h.DB.ExecContext(r.Context(), "INSERT IGNORE INTO message_reactions (message_id, kind, reactor_key, created_at) VALUES (?, ?, ?, ?)",
+		id, req.Kind, middleware.IPKey(r), time.Now())
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	counts, err := h.reactionCounts(r.Context(), []string{id})
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	event := model.ReactionEventMessage{
+		Type:      "reaction_updated",
+		ID:        id,
+		Reactions: counts[id],
+	}
+	if event.Reactions == nil {
+		event.Reactions = map[string]int{}
+	}
+
+	status := http.StatusOK
+	if added > 0 {
+		status = http.StatusCreated
+		logger.Info("added reaction", "kind", req.Kind)
+
+		// シャドウバンされた投稿へのリアクションは通知しない
+		shadowed, err := h.shadowedIDs(r.Context(), []string{id})
+		if err != nil {
+			logger.Error("failed to check shadowed messages", "error", err)
+		} else if !shadowed[id] {
+			h.Broadcast <- event
+			logger.Info("broadcasting reaction event", "id", id)
+		}
+	} else {
+		logger.Info("duplicate reaction ignored", "kind", req.Kind)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(event)
+}
+
+// reactionCounts returns reaction counts keyed by message ID and kind
+func (h *Handler) reactionCounts(ctx context.Context, ids []string) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT message_id, kind, COUNT(*) FROM message_reactions WHERE message_id IN (%s) GROUP BY message_id, kind",
+		strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "))
+	rows, err := h.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, kind string
+		var count int
+		if err := rows.Scan(&id, &kind, &count); err != nil {
+			return nil, err
+		}
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][kind] = count
+	}
+
+	return counts, rows.Err()
+}
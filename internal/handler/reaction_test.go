@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+func TestCreateReaction_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").
+		WithArgs("7", "pachi", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT\\(\\*\\) FROM message_reactions").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("7", "pachi", 3))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest("POST", "/messages/7/reactions", bytes.NewReader([]byte(`{"kind":"pachi"}`)))
+	req.RemoteAddr = "192.168.2.1:12345"
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var resp model.ReactionEventMessage
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Reactions["pachi"] != 3 {
+		t.Errorf("Expected pachi count 3, got %v", resp.Reactions)
+	}
+
+	select {
+	case event := <-h.Broadcast:
+		if event.EventType() != "reaction_updated" {
+			t.Errorf("Expected reaction_updated event, got %s", event.EventType())
+		}
+	default:
+		t.Error("Expected reaction_updated event to be broadcast")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReaction_Duplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT\\(\\*\\) FROM message_reactions").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("7", "pachi", 1))
+
+	req := httptest.NewRequest("POST", "/messages/7/reactions", bytes.NewReader([]byte(`{"kind":"pachi"}`)))
+	req.RemoteAddr = "192.168.2.2:12345"
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d for duplicate reaction, got %d", http.StatusOK, rr.Code)
+	}
+
+	if len(h.Broadcast) != 0 {
+		t.Error("Duplicate reaction should not be broadcast")
+	}
+}
+
+func TestCreateReaction_RotatingTokensCountOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{})
+	router := h.SetupRouter()
+
+	newRequest := func(token string) *http.Request {
+		req := httptest.NewRequest("POST", "/messages/7/reactions", bytes.NewReader([]byte(`{"kind":"pachi"}`)))
+		req.RemoteAddr = "192.168.2.4:12345"
+		req.Header.Set(middleware.ClientTokenHeader, token)
+		return req
+	}
+	// トークンを変えても同じIPアドレスからのリアクションは同じ reactor_key になる
+	reactorKey := middleware.IPKey(newRequest(""))
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").
+		WithArgs("7", "pachi", reactorKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT\\(\\*\\) FROM message_reactions").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("7", "pachi", 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").
+		WithArgs("7", "pachi", reactorKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT\\(\\*\\) FROM message_reactions").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("7", "pachi", 1))
+
+	for i, token := range []string{"token-a", "token-b"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRequest(token))
+
+		want := http.StatusCreated
+		if i > 0 {
+			want = http.StatusOK
+		}
+		if rr.Code != want {
+			t.Errorf("Expected status %d for reaction %d, got %d", want, i+1, rr.Code)
+		}
+	}
+
+	if len(h.Broadcast) != 1 {
+		t.Errorf("Expected 1 broadcast event, got %d", len(h.Broadcast))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReaction_UnknownKind(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	req := httptest.NewRequest("POST", "/messages/7/reactions", bytes.NewReader([]byte(`{"kind":"angry"}`)))
+	req.RemoteAddr = "192.168.2.3:12345"
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// Representations of message content. content は生のテキストで保存し、
+// レスポンスの表現（Accept で選択）に応じてエンコードする
+const (
+	// contentTypeJSON は content を HTML エスケープして返す既定の表現（ブラウザ向け）
+	contentTypeJSON = "application/json"
+	// contentTypeTextJSON は content を生のテキストのまま返す表現（エクスポート・ネイティブアプリ向け）
+	contentTypeTextJSON = "application/vnd.fuwapachi.text+json"
+)
+
+// messageContentType returns the representation of message content requested
+// by the Accept header of r
+func messageContentType(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != contentTypeTextJSON {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 {
+			continue
+		}
+		return contentTypeTextJSON
+	}
+	return contentTypeJSON
+}
+
+// renderMessage encodes the content of msg for the representation contentType
+func renderMessage(msg model.Message, contentType string) model.Message {
+	if contentType != contentTypeTextJSON {
+		msg.Content = html.EscapeString(msg.Content)
+	}
+	return msg
+}
+
+// renderMessages encodes the content of each message without modifying msgs
+func renderMessages(msgs []model.Message, contentType string) []model.Message {
+	rendered := make([]model.Message, len(msgs))
+	for i, msg := range msgs {
+		rendered[i] = renderMessage(msg, contentType)
+	}
+	return rendered
+}
+
+// writeMessageJSON writes v (a model.Message, []model.Message, model.MessagePage
+// or model.Thread) with the message content encoded for the representation
+// requested by r
+func writeMessageJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	contentType := messageContentType(r)
+
+	switch m := v.(type) {
+	case model.Message:
+		v = renderMessage(m, contentType)
+	case []model.Message:
+		v = renderMessages(m, contentType)
+	case model.MessagePage:
+		m.Messages = renderMessages(m.Messages, contentType)
+		v = m
+	case model.Thread:
+		m.Parent = renderMessage(m.Parent, contentType)
+		m.Replies = renderMessages(m.Replies, contentType)
+		v = m
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the JSON error response for code, with details given as
+// alternating keys and values (see apierror.New)
+func writeError(w http.ResponseWriter, r *http.Request, code apierror.Code, details ...any) {
+	middleware.WriteError(w, r, apierror.New(code, details...))
+}
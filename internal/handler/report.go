@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// CreateReport handles POST /messages/{id}/reports
+// 同じIPアドレスからの通報は理由や X-Client-Token に関係なく1回だけ数え、
+// 異なるIPアドレスからの通報が REPORT_HIDE_THRESHOLD 件に達したメッセージを非表示にする
+func (h *Handler) CreateReport(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var req model.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
+		return
+	}
+
+	if !model.ReportReasons[req.Reason] {
+		logger.Warn("bad request", "reason", "unknown reason", "value", req.Reason)
+		writeError(w, r, apierror.UnknownReason)
+		return
+	}
+
+	// シャドウバンされたクライアントの投稿は本人にだけ存在するように見せる
+	visible, visibleArgs := h.visibleTo(r)
+	var exists bool
+	err := h.DB.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND "+visible+")",
+		append([]interface{}{id}, visibleArgs...)...).Scan(&exists)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if !exists {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+
+	report := model.Report{MessageID: id, Reason: req.Reason, CreatedAt: time.Now()}
+
+	// 主キー (message_id, reporter_key) で重複を無視する。
+	// トークンを作り直して1人で閾値に達することができないよう、reporter_key はIPアドレスから作る
+	result, err := h.DB.ExecContext(r.Context(), "INSERT IGNORE INTO message_reports (message_id, reporter_key, reason, created_at) VALUES (?, ?, ?, ?)",
+		id, middleware.IPKey(r), report.Reason, report.CreatedAt)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	status := http.StatusOK
+	if added > 0 {
+		status = http.StatusCreated
+		logger.Info("reported message", "reason", report.Reason)
+
+		if err := h.hideIfReported(r.Context(), logger, id); err != nil {
+			logger.Error("database error", "error", err)
+			writeError(w, r, apierror.DatabaseError)
+			return
+		}
+	} else {
+		logger.Info("duplicate report ignored")
+	}
+
+	// 通報件数や非表示になったかどうかは通報者に返さない
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// hideIfReported hides the message once it has ReportHideThreshold reports
+// and broadcasts a message_hidden event unless the message is shadowed
+func (h *Handler) hideIfReported(ctx context.Context, logger *slog.Logger, id string) error {
+	if h.Config.ReportHideThreshold <= 0 {
+		return nil
+	}
+
+	var count int
+	if err := h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM message_reports WHERE message_id = ?", id).Scan(&count); err != nil {
+		return err
+	}
+	if count < h.Config.ReportHideThreshold {
+		return nil
+	}
+
+	hiddenAt := time.Now()
+	result, err := h.DB.ExecContext(ctx, "UPDATE messages SET hidden_at = ? WHERE id = ? AND hidden_at IS NULL", hiddenAt, id)
+	if err != nil {
+		return err
+	}
+	// 同時に閾値へ達した通報が複数あっても、イベントは非表示にした1回だけ送る
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	logger.Info("hidden message after reports", "count", count)
+	h.auditSystem(ctx, auditMessageHide, id, fmt.Sprintf("%d reports", count))
+
+	// シャドウバンされた投稿の非表示は通知しない
+	shadowed, err := h.shadowedIDs(ctx, []string{id})
+	if err != nil {
+		// 非表示にはできているため、ログのみ出力して通知を送らない
+		logger.Error("failed to check shadowed messages", "error", err)
+		return nil
+	}
+	if shadowed[id] {
+		return nil
+	}
+
+	h.Broadcast <- model.HiddenEventMessage{
+		Type:     "message_hidden",
+		ID:       id,
+		HiddenAt: hiddenAt,
+	}
+	logger.Info("broadcasting hidden event", "id", id)
+	return nil
+}
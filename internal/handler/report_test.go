@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+)
+
+func newReportRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/messages/7/reports", bytes.NewReader([]byte(body)))
+	req.RemoteAddr = "192.168.5.1:12345"
+	return req
+}
+
+func TestCreateReport_HidesAtThreshold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{ReportHideThreshold: 3})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").
+		WithArgs("7", sqlmock.AnyArg(), "spam", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reports WHERE message_id = \\?").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec("UPDATE messages SET hidden_at = \\? WHERE id = \\? AND hidden_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), "7").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newReportRequest(`{"reason":"spam"}`))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	select {
+	case event := <-h.Broadcast:
+		if event.EventType() != "message_hidden" {
+			t.Errorf("Expected message_hidden event, got %s", event.EventType())
+		}
+	default:
+		t.Error("Expected message_hidden event to be broadcast")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReport_BelowThreshold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{ReportHideThreshold: 3})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reports").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newReportRequest(`{"reason":"harassment"}`))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if len(h.Broadcast) != 0 {
+		t.Error("Expected no event below the threshold")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReport_DuplicateIgnored(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{ReportHideThreshold: 3}).SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newReportRequest(`{"reason":"spam"}`))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d for duplicate report, got %d", http.StatusOK, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReport_RotatingTokensCountOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{ReportHideThreshold: 2})
+	router := h.SetupRouter()
+
+	// トークンを変えても同じIPアドレスからの通報は同じ reporter_key になる
+	reporterKey := middleware.IPKey(newReportRequest(""))
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").
+		WithArgs("7", reporterKey, "spam", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reports").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").
+		WithArgs("7", reporterKey, "spam", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for i, token := range []string{"token-a", "token-b"} {
+		req := newReportRequest(`{"reason":"spam"}`)
+		req.Header.Set(middleware.ClientTokenHeader, token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		want := http.StatusCreated
+		if i > 0 {
+			want = http.StatusOK
+		}
+		if rr.Code != want {
+			t.Errorf("Expected status %d for report %d, got %d", want, i+1, rr.Code)
+		}
+	}
+
+	select {
+	case event := <-h.Broadcast:
+		t.Errorf("Expected no event, got %s", event.EventType())
+	default:
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReport_UnknownReason(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newReportRequest(`{"reason":"boring"}`))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
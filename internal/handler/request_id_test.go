@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+)
+
+func TestErrorResponse_RequestID(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	h := New(db, config.Config{})
+	router := middleware.RequestID(h.SetupRouter())
+
+	post := func(requestID string) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":""}`)))
+		if requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, requestID)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rr, body
+	}
+
+	// クライアントが指定した ID はそのまま使う
+	rr, body := post("req-123")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if got := rr.Header().Get(middleware.RequestIDHeader); got != "req-123" {
+		t.Errorf("Expected X-Request-ID req-123, got %q", got)
+	}
+	if body["request_id"] != "req-123" || body["error"] != "content is required" {
+		t.Errorf("Unexpected error body: %v", body)
+	}
+
+	// 不正な ID は置き換える
+	rr, body = post("bad id\x7f")
+	id := rr.Header().Get(middleware.RequestIDHeader)
+	if id == "" || id == "bad id\x7f" {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+	if body["request_id"] != id {
+		t.Errorf("Expected request_id %q in body, got %q", id, body["request_id"])
+	}
+}
+
+func TestIdempotentReplay_RequestID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	router := middleware.RequestID(New(db, config.Config{}).SetupRouter())
+
+	body := `{"content":"retry me"}`
+	sum := sha256.Sum256([]byte(body))
+	stored := `{"id":"1","content":"retry me","created_at":"2026-01-29T12:00:00Z"}`
+	mock.ExpectExec("INSERT IGNORE INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE key_hash = \\? AND created_at < \\?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash, status, content_type, body FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "body"}).
+			AddRow(hex.EncodeToString(sum[:]), http.StatusCreated, "application/json", stored))
+
+	// 再送したレスポンスのボディは保存したままで、X-Request-ID は再送したリクエストのもの
+	req := newIdempotentRequest(body)
+	req.Header.Set(middleware.RequestIDHeader, "req-retry")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Body.String() != stored {
+		t.Errorf("Expected stored body %s, got %s", stored, rr.Body.String())
+	}
+	if got := rr.Header().Get(middleware.RequestIDHeader); got != "req-retry" {
+		t.Errorf("Expected X-Request-ID req-retry, got %q", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
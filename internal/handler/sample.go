@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fuwapachi/internal/model"
+)
+
+const (
+	// candidateFactor は削除済みのギャップを考慮して、要求件数の何倍の候補IDを生成するか
+	candidateFactor = 5
+	// maxExcludedIDs は exclude / seen で受け付けるIDの最大数
+	maxExcludedIDs = 1000
+	// seenTokenHeader は表示済みIDの集合を返すレスポンスヘッダー
+	seenTokenHeader = "X-Seen-Token"
+)
+
+var errInvalidSeenToken = errors.New("invalid seen token")
+
+// parseExclusions reads the exclude=1,2,3 and seen=<token> query parameters
+func parseExclusions(q url.Values) (map[int]bool, error) {
+	exclude := make(map[int]bool)
+
+	if v := q.Get("exclude"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || id < 1 {
+				return nil, fmt.Errorf("invalid id in exclude: %q", s)
+			}
+			exclude[id] = true
+		}
+	}
+
+	if v := q.Get("seen"); v != "" {
+		ids, err := decodeSeenToken(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			exclude[id] = true
+		}
+	}
+
+	if len(exclude) > maxExcludedIDs {
+		return nil, fmt.Errorf("too many excluded ids (max %d)", maxExcludedIDs)
+	}
+
+	return exclude, nil
+}
+
+// encodeSeenToken encodes a set of IDs as base64url of uvarint deltas of the sorted IDs.
+// 件数が maxExcludedIDs を超える場合は新しい（大きい）IDを優先して残す
+func encodeSeenToken(ids map[int]bool) string {
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+	if len(sorted) > maxExcludedIDs {
+		sorted = sorted[len(sorted)-maxExcludedIDs:]
+	}
+
+	buf := make([]byte, 0, len(sorted)*2)
+	prev := 0
+	for _, id := range sorted {
+		buf = binary.AppendUvarint(buf, uint64(id-prev))
+		prev = id
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeSeenToken(token string) ([]int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidSeenToken
+	}
+
+	var ids []int
+	prev := 0
+	for len(buf) > 0 {
+		delta, n := binary.Uvarint(buf)
+		if n <= 0 || delta == 0 || delta > uint64(1<<31) {
+			return nil, errInvalidSeenToken
+		}
+		buf = buf[n:]
+		prev += int(delta)
+		ids = append(ids, prev)
+		if len(ids) > maxExcludedIDs {
+			return nil, errInvalidSeenToken
+		}
+	}
+	return ids, nil
+}
+
+// randomCandidates returns up to n distinct random IDs in 1..maxID that are not excluded
+func randomCandidates(maxID, n int, exclude map[int]bool) []int {
+	available := maxID
+	for id := range exclude {
+		if id <= maxID {
+			available--
+		}
+	}
+	if n > available {
+		n = available
+	}
+
+	selected := make(map[int]bool, n)
+	candidates := make([]int, 0, n)
+	for len(candidates) < n {
+		id := rand.Intn(maxID) + 1
+		if !selected[id] && !exclude[id] {
+			selected[id] = true
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+// shuffledExclusions returns the excluded IDs in 1..maxID in random order
+func shuffledExclusions(maxID int, exclude map[int]bool) []int {
+	ids := make([]int, 0, len(exclude))
+	for id := range exclude {
+		if id <= maxID {
+			ids = append(ids, id)
+		}
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	return ids
+}
+
+// sampleMessages fetches up to limit messages among candidate IDs that
+// match the visibility condition visible (with its arguments visibleArgs)
+func (h *Handler) sampleMessages(ctx context.Context, candidates []int, limit int, visible string, visibleArgs []interface{}) ([]model.Message, error) {
+	if len(candidates) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, 0, len(candidates)+len(visibleArgs)+1)
+	for _, id := range candidates {
+		args = append(args, id)
+	}
+	inClause := strings.TrimSuffix(strings.Repeat("?, ", len(candidates)), ", ")
+
+	query := fmt.Sprintf("SELECT id, content, created_at, parent_id FROM messages WHERE id IN (%s) AND %s LIMIT ?", inClause, visible)
+	args = append(args, visibleArgs...)
+	args = append(args, limit)
+
+	rows, err := h.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgList []model.Message
+	for rows.Next() {
+		var msg model.Message
+		var parentID sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.Content, &msg.CreatedAt, &parentID); err != nil {
+			continue
+		}
+		if parentID.Valid {
+			msg.ParentID = &parentID.String
+		}
+		msgList = append(msgList, msg)
+	}
+	return msgList, rows.Err()
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestSeenToken_RoundTrip(t *testing.T) {
+	ids := map[int]bool{1: true, 2: true, 300: true, 70000: true}
+
+	decoded, err := decodeSeenToken(encodeSeenToken(ids))
+	if err != nil {
+		t.Fatalf("Failed to decode seen token: %v", err)
+	}
+
+	if len(decoded) != len(ids) {
+		t.Fatalf("Expected %d ids, got %v", len(ids), decoded)
+	}
+	for _, id := range decoded {
+		if !ids[id] {
+			t.Errorf("Unexpected id %d in decoded token", id)
+		}
+	}
+
+	if _, err := decodeSeenToken("AA"); err == nil {
+		t.Error("Expected zero delta to be rejected")
+	}
+}
+
+func TestGetMessages_PrefersUnseen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}}).SetupRouter()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(id\\), 0\\) FROM messages").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(3))
+	// 未表示の候補は id=3 のみ
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id FROM messages WHERE id IN \\(\\?\\)").
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).AddRow("3", "unseen", now, nil))
+	// 足りない分は表示済みの id=1,2 から補う
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id FROM messages WHERE id IN \\(\\?, \\?\\)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).AddRow("1", "seen", now, nil))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	req := httptest.NewRequest("GET", "/messages?count=2&exclude=1,2", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var msgList []model.Message
+	json.Unmarshal(rr.Body.Bytes(), &msgList)
+	if len(msgList) != 2 || msgList[0].ID != "3" {
+		t.Errorf("Expected unseen message first, got %+v", msgList)
+	}
+
+	seen, err := decodeSeenToken(rr.Header().Get(seenTokenHeader))
+	if err != nil || len(seen) != 3 {
+		t.Errorf("Expected seen token with 3 ids, got %v (%v)", seen, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetMessages_InvalidCount(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{
+		AllowedOrigins:        []string{"http://localhost:8080"},
+		MaxMessagesPerRequest: 20,
+	}).SetupRouter()
+
+	for _, query := range []string{"count=0", "count=21", "count=abc", "exclude=1,x", "seen=!!"} {
+		req := httptest.NewRequest("GET", "/messages?"+query, nil)
+		req.Header.Set("Origin", "http://localhost:8080")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
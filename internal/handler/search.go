@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+)
+
+const (
+	// maxSearchQueryLength は検索クエリの最大文字数
+	maxSearchQueryLength = 100
+	// maxSearchTerms は検索クエリに含められる語の最大数
+	maxSearchTerms = 10
+	// minFulltextTermLength は FULLTEXT（ngram_token_size=2）で検索できる最小文字数。
+	// これより短い語を含むクエリは LIKE で検索する
+	minFulltextTermLength = 2
+)
+
+// likeEscaper escapes LIKE wildcards using the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchMessages handles GET /messages/search?q=
+// すべての語を含む未削除のメッセージを新しい順にページネーションして返す
+func (h *Handler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	if !h.checkReadOrigin(w, r) {
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	terms := strings.Fields(q)
+	if len(terms) == 0 || utf8.RuneCountInString(q) > maxSearchQueryLength || len(terms) > maxSearchTerms {
+		logger.Warn("bad request", "reason", "invalid query", "value", q)
+		writeError(w, r, apierror.InvalidQuery)
+		return
+	}
+
+	visible, args := h.visibleTo(r)
+	where, searchArgs := h.searchCondition(terms)
+	h.writeMessagePage(w, r, "newest", []string{visible, where}, append(args, searchArgs...))
+}
+
+// searchCondition builds the WHERE condition matching all terms
+func (h *Handler) searchCondition(terms []string) (string, []interface{}) {
+	useFulltext := h.Config.SearchBackend == "fulltext"
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minFulltextTermLength {
+			useFulltext = false
+		}
+	}
+
+	if useFulltext {
+		// BOOLEAN MODE で各語をフレーズとして必須にする（ngram パーサでは連続したトークン列として一致）
+		var b strings.Builder
+		for i, term := range terms {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(`+"` + strings.ReplaceAll(term, `"`, "") + `"`)
+		}
+		return "MATCH(content) AGAINST (? IN BOOLEAN MODE)", []interface{}{b.String()}
+	}
+
+	conds := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		conds[i] = "content LIKE ?"
+		args[i] = "%" + likeEscaper.Replace(term) + "%"
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", args
+}
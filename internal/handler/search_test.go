@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+)
+
+func TestSearchMessages_Fulltext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080"},
+		SearchBackend:  "fulltext",
+	}).SetupRouter()
+
+	mock.ExpectQuery("WHERE deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL AND MATCH\\(content\\) AGAINST \\(\\? IN BOOLEAN MODE\\) ORDER BY created_at DESC, id DESC").
+		WithArgs(`+"ふわぱち" +"<b>"`, defaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}))
+
+	req := httptest.NewRequest("GET", "/messages/search?q="+url.QueryEscape(`ふわぱち <b>`), nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSearchMessages_LikeFallback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	// 1文字の語は ngram で検索できないため fulltext 設定でも LIKE になる
+	router := New(db, config.Config{
+		AllowedOrigins: []string{"http://localhost:8080"},
+		SearchBackend:  "fulltext",
+	}).SetupRouter()
+
+	mock.ExpectQuery("WHERE deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL AND \\(content LIKE \\? AND content LIKE \\?\\)").
+		WithArgs("%猫%", `%100\%%`, 6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}))
+
+	req := httptest.NewRequest("GET", "/messages/search?limit=5&q="+url.QueryEscape("猫 100%"), nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSearchMessages_EmptyQuery(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}}).SetupRouter()
+
+	req := httptest.NewRequest("GET", "/messages/search?q=+", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -43,20 +43,39 @@ func TestSecurity_XSS(t *testing.T) {
 		t.Fatalf("Failed to open sqlmock database: %s", err)
 	}
 
-	// 期待されるSQLのモック（エスケープされた文字列が渡されることを確認）
-	mock.ExpectExec("INSERT INTO messages").
-		WithArgs("&lt;script&gt;alert(&#39;XSS&#39;)&lt;/script&gt;", sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	body := []byte(`{"content":"<script>alert('XSS')</script>"}`)
-	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
-	req.RemoteAddr = "192.168.1.1:12345"
-	rr := httptest.NewRecorder()
+	// 期待されるSQLのモック（生の文字列が保存され、エスケープは出力時に行われることを確認）
+	raw := "<script>alert('XSS')</script>"
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", "&lt;script&gt;alert(&#39;XSS&#39;)&lt;/script&gt;"},
+		{contentTypeTextJSON, raw},
+	} {
+		mock.ExpectExec("INSERT INTO messages").
+			WithArgs(raw, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		body, _ := json.Marshal(map[string]string{"content": raw})
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+		req.RemoteAddr = "192.168.1.1:12345"
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
 
-	r.ServeHTTP(rr, req)
+		r.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		if status := rr.Code; status != http.StatusCreated {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		}
+		var msg struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &msg)
+		if msg.Content != tt.want {
+			t.Errorf("Accept %q: expected content %q, got %q", tt.accept, tt.want, msg.Content)
+		}
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/ban"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// auditReasonShadowBan is the audit reason of messages posted by shadow-banned clients
+const auditReasonShadowBan = "shadow_ban"
+
+// tokenKey returns the identifier of X-Client-Token, or "" when r has no token
+func tokenKey(r *http.Request) string {
+	if strings.TrimSpace(r.Header.Get(middleware.ClientTokenHeader)) == "" {
+		return ""
+	}
+	return middleware.ClientKey(r)
+}
+
+// shadowBanned reports whether the sender of r is shadow-banned
+func (h *Handler) shadowBanned(r *http.Request) bool {
+	return h.ShadowBans.Contains(middleware.ClientIP(r), tokenKey(r))
+}
+
+// visibleTo returns the condition (and its arguments) of the messages shown
+// to the sender of r. シャドウバンされたクライアントには自分の投稿も表示し、
+// 投稿が公開されていないことに気付かれないようにする。トークンを付け外し・変更しても
+// 気付かれないよう、投稿時のIPアドレスとトークンのどちらかが一致すれば表示する
+func (h *Handler) visibleTo(r *http.Request) (string, []interface{}) {
+	if !h.shadowBanned(r) {
+		return visibleCondition, nil
+	}
+	return "(" + visibleCondition + " OR (deleted_at IS NULL AND hidden_at IS NULL AND status = 'shadowed' AND (shadow_key = ? OR shadow_token_key = ?)))",
+		[]interface{}{middleware.IPKey(r), tokenKey(r)}
+}
+
+// shadowedIDs returns the IDs in ids of shadowed messages, whose events must
+// not be broadcast (他のクライアントに投稿の存在や操作を知らせない)
+func (h *Handler) shadowedIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	shadowed := make(map[string]bool)
+	if len(ids) == 0 {
+		return shadowed, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT id FROM messages WHERE id IN (%s) AND status = 'shadowed'",
+		strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "))
+	rows, err := h.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		shadowed[id] = true
+	}
+	return shadowed, rows.Err()
+}
+
+// ListShadowBans handles GET /admin/shadow-bans
+func (h *Handler) ListShadowBans(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	bans := h.ShadowBans.Active()
+
+	logger.Info("returned shadow bans", "count", len(bans))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// CreateShadowBan handles POST /admin/shadow-bans
+// 同じクライアントがすでにシャドウバンされている場合は理由を上書きする
+func (h *Handler) CreateShadowBan(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+
+	var req model.ShadowBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn("bad request", "error", err)
+		writeError(w, r, apierror.InvalidBody)
+		return
+	}
+
+	if utf8.RuneCountInString(req.Reason) > maxModerationReasonLength {
+		logger.Warn("bad request", "reason", "reason too long")
+		writeError(w, r, apierror.ReasonTooLong, "max", maxModerationReasonLength)
+		return
+	}
+
+	b, err := h.ShadowBans.Add(r.Context(), model.ShadowBan{
+		ActorType: req.ActorType,
+		ActorID:   strings.TrimSpace(req.ActorID),
+		Reason:    req.Reason,
+		CreatedBy: middleware.AdminName(r),
+		CreatedAt: time.Now(),
+	})
+	if errors.Is(err, ban.ErrInvalidActor) {
+		logger.Warn("bad request", "reason", "invalid actor", "actor_type", req.ActorType, "actor_id", req.ActorID)
+		writeError(w, r, apierror.InvalidActor)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	logger.Info("shadow-banned", "actor_type", b.ActorType, "actor_id", b.ActorID)
+	h.audit(r, auditShadowBanCreate, "", shadowBanAuditReason(b.ActorType, b.ActorID, b.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// DeleteShadowBan handles DELETE /admin/shadow-bans/{actor_type}/{actor_id}
+// 解除前の投稿は公開されないまま残る
+func (h *Handler) DeleteShadowBan(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	vars := mux.Vars(r)
+	actorType, actorID := vars["actor_type"], vars["actor_id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	removed, err := h.ShadowBans.Remove(r.Context(), actorType, actorID)
+	if errors.Is(err, ban.ErrInvalidActor) {
+		logger.Warn("bad request", "reason", "invalid actor")
+		writeError(w, r, apierror.InvalidActor)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+
+	if !removed {
+		logger.Warn("not found")
+		writeError(w, r, apierror.ShadowBanNotFound)
+		return
+	}
+
+	logger.Info("removed shadow ban")
+	h.audit(r, auditShadowBanDelete, "", shadowBanAuditReason(actorType, actorID, ""))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shadowBanAuditReason records the actor in the reason, since target_id
+// only holds numeric IDs
+func shadowBanAuditReason(actorType, actorID, reason string) string {
+	s := actorType + " " + actorID
+	if reason != "" {
+		s += ": " + reason
+	}
+	if runes := []rune(s); len(runes) > maxModerationReasonLength {
+		s = string(runes[:maxModerationReasonLength])
+	}
+	return s
+}
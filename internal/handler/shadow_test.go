@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/ban"
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+func newShadowBannedHandler(t *testing.T) (*Handler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}})
+	mock.ExpectExec("INSERT INTO shadow_bans").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := h.ShadowBans.Add(context.Background(), model.ShadowBan{ActorType: ban.ActorIP, ActorID: "192.0.2.66", CreatedBy: "admin", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	return h, mock
+}
+
+func TestCreateMessage_ShadowBanned(t *testing.T) {
+	h, mock := newShadowBannedHandler(t)
+	router := h.SetupRouter()
+
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"buy now"}`)))
+	req.RemoteAddr = "192.0.2.66:12345"
+
+	// 保存時は shadowed とし、投稿者のクライアント識別子を記録する
+	mock.ExpectExec("INSERT INTO messages").
+		WithArgs("buy now", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, model.StatusShadowed, middleware.IPKey(req), nil, middleware.IPKey(req)).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec("INSERT INTO audit_events").
+		WithArgs(sqlmock.AnyArg(), "ip", "192.0.2.66", "192.0.2.66", auditMessageCreate, "9", auditReasonShadowBan).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// 投稿者には通常どおり成功したように見える
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var msg model.Message
+	if err := json.Unmarshal(rr.Body.Bytes(), &msg); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if msg.ID != "9" || msg.Status != model.StatusApproved {
+		t.Errorf("Unexpected response %+v", msg)
+	}
+	if len(h.Broadcast) != 0 {
+		t.Errorf("Expected no broadcast, got %d events", len(h.Broadcast))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListMessages_ShadowBannedSeesOwnMessages(t *testing.T) {
+	h, mock := newShadowBannedHandler(t)
+	router := h.SetupRouter()
+
+	// 他のクライアントには公開されたメッセージのみ
+	mock.ExpectQuery("WHERE deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL ORDER BY").
+		WithArgs(defaultPageLimit + 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}))
+
+	req := httptest.NewRequest("GET", "/messages?order=newest", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.RemoteAddr = "198.51.100.1:1234"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// シャドウバンされたクライアントには自分の投稿も含める
+	req = httptest.NewRequest("GET", "/messages?order=newest", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.RemoteAddr = "192.0.2.66:1234"
+	mock.ExpectQuery("WHERE \\(deleted_at IS NULL AND status = 'approved' AND hidden_at IS NULL OR \\(.+status = 'shadowed' AND \\(shadow_key = \\? OR shadow_token_key = \\?\\)\\)\\) ORDER BY").
+		WithArgs(middleware.IPKey(req), "", defaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).
+			AddRow(9, "buy now", time.Now(), nil))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var page model.MessagePage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != "9" {
+		t.Errorf("Expected own shadowed message, got %+v", page.Messages)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// shadowedCondition は visibleTo がシャドウバンされたクライアントに追加する条件
+const shadowedCondition = "status = 'shadowed' AND \\(shadow_key = \\? OR shadow_token_key = \\?\\)"
+
+func TestGetThread_ShadowBannedSeesOwnThread(t *testing.T) {
+	h, mock := newShadowBannedHandler(t)
+	router := h.SetupRouter()
+
+	req := httptest.NewRequest("GET", "/messages/9/thread", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.RemoteAddr = "192.0.2.66:1234"
+	key := middleware.IPKey(req)
+
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id FROM messages WHERE id = \\? AND .+"+shadowedCondition).
+		WithArgs("9", key, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).AddRow("9", "buy now", time.Now(), nil))
+	mock.ExpectQuery("SELECT id, content, created_at FROM messages WHERE parent_id = \\? AND .+"+shadowedCondition).
+		WithArgs("9", key, "", maxThreadReplies).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at"}).AddRow("10", "cheap", time.Now()))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var thread model.Thread
+	if err := json.Unmarshal(rr.Body.Bytes(), &thread); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if thread.Parent.ID != "9" || len(thread.Replies) != 1 {
+		t.Errorf("Expected own shadowed thread, got %+v", thread)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestShadowBanned_InteractsWithOwnMessage(t *testing.T) {
+	h, mock := newShadowBannedHandler(t)
+	router := h.SetupRouter()
+
+	newRequest := func(path, body string) *http.Request {
+		req := httptest.NewRequest("POST", path, bytes.NewReader([]byte(body)))
+		req.RemoteAddr = "192.0.2.66:12345"
+		return req
+	}
+	key := middleware.IPKey(newRequest("/", ""))
+
+	// 自分の投稿への返信
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM messages WHERE id = \\? AND .+"+shadowedCondition).
+		WithArgs("9", key, "").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT INTO messages").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("/messages", `{"content":"me too","parent_id":"9"}`))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected reply status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 自分の投稿へのリアクション
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM messages WHERE id = \\? AND .+"+shadowedCondition).
+		WithArgs("9", key, "").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("9", "pachi", 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("/messages/9/reactions", `{"kind":"pachi"}`))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected reaction status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 自分の投稿への通報
+	mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM messages WHERE id = \\? AND .+"+shadowedCondition).
+		WithArgs("9", key, "").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("/messages/9/reports", `{"reason":"spam"}`))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected report status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 他のクライアントには返信もリアクションも通知しない
+	if len(h.Broadcast) != 0 {
+		t.Errorf("Expected no broadcast, got %d events", len(h.Broadcast))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestShadowBanned_SeesOwnMessagesAfterTokenChange(t *testing.T) {
+	h, _ := newShadowBannedHandler(t)
+
+	// 投稿時のIPアドレスとトークンの両方を条件に含め、トークンを付け外し・変更しても自分の投稿が見える
+	for _, token := range []string{"", "token-a", "token-b"} {
+		req := httptest.NewRequest("GET", "/messages", nil)
+		req.RemoteAddr = "192.0.2.66:1234"
+		if token != "" {
+			req.Header.Set(middleware.ClientTokenHeader, token)
+		}
+
+		_, args := h.visibleTo(req)
+		if len(args) != 2 || args[0] != middleware.IPKey(req) || args[1] != tokenKey(req) {
+			t.Errorf("token %q: unexpected arguments %v", token, args)
+		}
+	}
+}
+
+func TestShadowedMessage_EventsNotBroadcast(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	defer db.Close()
+
+	h := New(db, config.Config{ReportHideThreshold: 1, ThreadDeleteCascade: true})
+	router := h.SetupRouter()
+
+	newRequest := func(method, path, body string) *http.Request {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.RemoteAddr = "198.51.100.7:12345"
+		return req
+	}
+	shadowedQuery := "SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'"
+
+	// シャドウバンされた投稿へのリアクション
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reactions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}).AddRow("9", "pachi", 1))
+	mock.ExpectQuery(shadowedQuery).WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9"))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("POST", "/messages/9/reactions", `{"kind":"pachi"}`))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected reaction status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 通報による非表示
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT IGNORE INTO message_reports").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reports").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE messages SET hidden_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(shadowedQuery).WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("POST", "/messages/9/reports", `{"reason":"spam"}`))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected report status %d, got %d. Body: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// 削除（シャドウバンされた返信の削除も含む）。公開されている返信の削除だけを通知する
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("UPDATE messages SET deleted_at = \\? WHERE id = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE parent_id IN").WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("10").AddRow("11"))
+	mock.ExpectExec("UPDATE messages SET deleted_at = \\? WHERE id IN").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SELECT id FROM messages WHERE parent_id IN").WithArgs("10", "11").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO audit_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(shadowedQuery).WithArgs("9", "10", "11").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9").AddRow("10"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newRequest("DELETE", "/messages/9", ""))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected delete status %d, got %d. Body: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	if len(h.Broadcast) != 1 {
+		t.Fatalf("Expected only the delete event of the visible reply, got %d events", len(h.Broadcast))
+	}
+	if event, ok := (<-h.Broadcast).(model.DeleteEventMessage); !ok || event.ID != "11" {
+		t.Errorf("Expected message_deleted for 11, got %+v", event)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/model"
+)
+
+// maxThreadReplies は GET /messages/{id}/thread で返す返信の最大件数
+const maxThreadReplies = 100
+
+// GetThread handles GET /messages/{id}/thread
+// 親メッセージと公開されている返信（古い順）を返す
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
+	id := mux.Vars(r)["id"]
+	logger.Info("request received", "remote_addr", r.RemoteAddr)
+
+	if !h.checkReadOrigin(w, r) {
+		return
+	}
+
+	// シャドウバンされたクライアントには自分の投稿のスレッドも表示する
+	visible, visibleArgs := h.visibleTo(r)
+
+	var thread model.Thread
+	var parentID sql.NullString
+	err := h.DB.QueryRowContext(r.Context(), "SELECT id, content, created_at, parent_id FROM messages WHERE id = ? AND "+visible,
+		append([]interface{}{id}, visibleArgs...)...).
+		Scan(&thread.Parent.ID, &thread.Parent.Content, &thread.Parent.CreatedAt, &parentID)
+	if err == sql.ErrNoRows {
+		logger.Warn("not found")
+		writeError(w, r, apierror.MessageNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	if parentID.Valid {
+		thread.Parent.ParentID = &parentID.String
+	}
+
+	args := append([]interface{}{id}, visibleArgs...)
+	rows, err := h.DB.QueryContext(r.Context(), "SELECT id, content, created_at FROM messages WHERE parent_id = ? AND "+visible+" ORDER BY created_at, id LIMIT ?",
+		append(args, maxThreadReplies)...)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	defer rows.Close()
+
+	thread.Replies = []model.Message{}
+	for rows.Next() {
+		reply := model.Message{ParentID: &thread.Parent.ID}
+		if err := rows.Scan(&reply.ID, &reply.Content, &reply.CreatedAt); err != nil {
+			continue
+		}
+		thread.Replies = append(thread.Replies, reply)
+	}
+
+	// リアクション件数を付与
+	ids := []string{thread.Parent.ID}
+	for _, reply := range thread.Replies {
+		ids = append(ids, reply.ID)
+	}
+	counts, err := h.reactionCounts(r.Context(), ids)
+	if err != nil {
+		logger.Error("database error", "error", err)
+		writeError(w, r, apierror.DatabaseError)
+		return
+	}
+	thread.Parent.Reactions = counts[thread.Parent.ID]
+	for i := range thread.Replies {
+		thread.Replies[i].Reactions = counts[thread.Replies[i].ID]
+	}
+
+	logger.Info("returned thread", "replies", len(thread.Replies))
+
+	writeMessageJSON(w, r, http.StatusOK, thread)
+}
+
+// deleteReplies soft-deletes all live descendants of parentID and returns their IDs
+func (h *Handler) deleteReplies(ctx context.Context, parentID string, now time.Time) ([]string, error) {
+	var deleted []string
+	parents := []string{parentID}
+
+	for len(parents) > 0 {
+		args := make([]interface{}, len(parents))
+		for i, id := range parents {
+			args[i] = id
+		}
+		inClause := strings.TrimSuffix(strings.Repeat("?, ", len(parents)), ", ")
+
+		rows, err := h.DB.QueryContext(ctx, fmt.Sprintf("SELECT id FROM messages WHERE parent_id IN (%s) AND deleted_at IS NULL", inClause), args...)
+		if err != nil {
+			return deleted, err
+		}
+		var children []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			children = append(children, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return deleted, err
+		}
+
+		if len(children) == 0 {
+			break
+		}
+
+		updateArgs := []interface{}{now}
+		for _, id := range children {
+			updateArgs = append(updateArgs, id)
+		}
+		query := fmt.Sprintf("UPDATE messages SET deleted_at = ? WHERE id IN (%s) AND deleted_at IS NULL",
+			strings.TrimSuffix(strings.Repeat("?, ", len(children)), ", "))
+		if _, err := h.DB.ExecContext(ctx, query, updateArgs...); err != nil {
+			return deleted, err
+		}
+
+		deleted = append(deleted, children...)
+		parents = children
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"fuwapachi/internal/config"
+	"fuwapachi/internal/model"
+)
+
+func TestGetThread(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{AllowedOrigins: []string{"http://localhost:8080"}}).SetupRouter()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, content, created_at, parent_id FROM messages WHERE id = \\?").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at", "parent_id"}).AddRow("1", "parent", now, nil))
+	mock.ExpectQuery("SELECT id, content, created_at FROM messages WHERE parent_id = \\?").WithArgs("1", maxThreadReplies).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "created_at"}).
+			AddRow("2", "reply 1", now).
+			AddRow("3", "reply 2", now))
+	mock.ExpectQuery("SELECT message_id, kind, COUNT").WithArgs("1", "2", "3").
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "kind", "count"}))
+
+	req := httptest.NewRequest("GET", "/messages/1/thread", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var thread model.Thread
+	json.Unmarshal(rr.Body.Bytes(), &thread)
+
+	if thread.Parent.ID != "1" || len(thread.Replies) != 2 {
+		t.Fatalf("Unexpected thread: %+v", thread)
+	}
+	if thread.Replies[0].ParentID == nil || *thread.Replies[0].ParentID != "1" {
+		t.Errorf("Expected replies to reference parent 1, got %v", thread.Replies[0].ParentID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMessage_ReplyToMissingParent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	router := New(db, config.Config{}).SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("99").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader([]byte(`{"content":"hi","parent_id":"99"}`)))
+	req.RemoteAddr = "192.168.3.1:12345"
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteMessage_CascadesToReplies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open sqlmock database: %s", err)
+	}
+	h := New(db, config.Config{ThreadDeleteCascade: true})
+	router := h.SetupRouter()
+
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("UPDATE messages SET deleted_at = \\? WHERE id = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE parent_id IN").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+	mock.ExpectExec("UPDATE messages SET deleted_at = \\? WHERE id IN").
+		WithArgs(sqlmock.AnyArg(), "2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM messages WHERE parent_id IN").WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT id FROM messages WHERE id IN \\(.+\\) AND status = 'shadowed'").WithArgs("1", "2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest("DELETE", "/messages/1", nil)
+	req.RemoteAddr = "192.168.3.2:12345"
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if len(h.Broadcast) != 2 {
+		t.Errorf("Expected delete events for parent and reply, got %d", len(h.Broadcast))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
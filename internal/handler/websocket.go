@@ -1,10 +1,20 @@
 package handler
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/broadcast"
+	"fuwapachi/internal/middleware"
+	"fuwapachi/internal/tracing"
 )
 
 // createUpgrader creates a WebSocket upgrader with the given allowed origins
@@ -19,15 +29,31 @@ func createUpgrader(allowedOrigins []string) websocket.Upgrader {
 			origin := r.Header.Get("Origin")
 			return allowedMap[origin]
 		},
+		Error: writeUpgradeError,
+	}
+}
+
+// writeUpgradeError writes a failed WebSocket handshake in the unified error format
+func writeUpgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	code := apierror.InvalidHandshake
+	switch {
+	case status == http.StatusForbidden:
+		code = apierror.ForbiddenOrigin
+	case status == http.StatusMethodNotAllowed:
+		code = apierror.MethodNotAllowed
+	case status >= 500:
+		code = apierror.InternalError
 	}
+	writeError(w, r, code)
 }
 
 // HandleWebSocket handles GET /ws
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	logger := middleware.Logger(r)
 	upgrader := createUpgrader(h.Config.AllowedOrigins)
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		logger.Error("websocket upgrade failed", "error", err)
 		return
 	}
 	defer conn.Close()
@@ -37,7 +63,11 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	totalClients := len(h.Clients)
 	h.ClientMu.Unlock()
 
-	log.Printf("New WebSocket connection. Total clients: %d", totalClients)
+	logger.Info("websocket client connected", "clients", totalClients)
+
+	// 接続したクライアントには現在の接続数を即座に送る
+	h.sendPresence(conn)
+	h.notifyPresence()
 
 	// クライアントからのメッセージを受信（キープアライブ用）
 	for {
@@ -47,32 +77,92 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			delete(h.Clients, conn)
 			remainingClients := len(h.Clients)
 			h.ClientMu.Unlock()
-			log.Printf("[WebSocket] Client disconnected. Total clients: %d", remainingClients)
+			logger.Info("websocket client disconnected", "clients", remainingClients)
+			h.notifyPresence()
 			break
 		}
 	}
 }
 
-// HandleBroadcast broadcasts delete events to all connected WebSocket clients
+// HandleBroadcast publishes local events to the backplane and delivers
+// every event received from the backplane to all connected WebSocket clients
 func (h *Handler) HandleBroadcast() {
-	for event := range h.Broadcast {
-		// clients マップをスナップショットしてからロックを外すことで、
-		// range 中に delete して "concurrent map iteration and map write"
-		// が発生するのを防ぐ
-		h.ClientMu.RLock()
-		clientsSnapshot := make([]*websocket.Conn, 0, len(h.Clients))
-		for client := range h.Clients {
+	go h.publishEvents()
+	go h.runPresence()
+
+	// WebSocketへの書き込みはこのゴルーチンだけが行う
+	// （gorilla/websocket は並行書き込みをサポートしない）
+	events := h.Backplane.Subscribe()
+	for {
+		select {
+		case env, ok := <-events:
+			if !ok {
+				return
+			}
+			if env.Type == presenceCountType {
+				h.receivePresence(env.Payload)
+				continue
+			}
+			h.writeToClients(nil, env.Type, env.Payload)
+		case d := <-h.localEvents:
+			h.writeToClients(d.conn, "presence", d.payload)
+		}
+	}
+}
+
+// writeToClients writes payload to target, or to every client when target is nil
+func (h *Handler) writeToClients(target *websocket.Conn, eventType string, payload []byte) {
+	_, span := tracing.Tracer().Start(context.Background(), "broadcast.fanout",
+		trace.WithAttributes(attribute.String("event.type", eventType)))
+	defer span.End()
+
+	// clients マップをスナップショットしてからロックを外すことで、
+	// range 中に delete して "concurrent map iteration and map write"
+	// が発生するのを防ぐ
+	h.ClientMu.RLock()
+	clientsSnapshot := make([]*websocket.Conn, 0, len(h.Clients))
+	for client := range h.Clients {
+		if target == nil || client == target {
 			clientsSnapshot = append(clientsSnapshot, client)
 		}
-		h.ClientMu.RUnlock()
-
-		for _, client := range clientsSnapshot {
-			if err := client.WriteJSON(event); err != nil {
-				client.Close()
-				h.ClientMu.Lock()
-				delete(h.Clients, client)
-				h.ClientMu.Unlock()
-			}
+	}
+	h.ClientMu.RUnlock()
+
+	failed := 0
+	for _, client := range clientsSnapshot {
+		if err := client.WriteMessage(websocket.TextMessage, payload); err != nil {
+			failed++
+			client.Close()
+			h.ClientMu.Lock()
+			delete(h.Clients, client)
+			h.ClientMu.Unlock()
+			h.notifyPresence()
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("broadcast.clients", len(clientsSnapshot)),
+		attribute.Int("broadcast.failed", failed),
+	)
+}
+
+// publishEvents forwards events queued on h.Broadcast to the backplane
+func (h *Handler) publishEvents() {
+	for event := range h.Broadcast {
+		env, err := broadcast.Encode(event)
+		if err != nil {
+			slog.Error("failed to encode event", "error", err)
+			continue
+		}
+
+		ctx, span := tracing.Tracer().Start(context.Background(), "broadcast.publish",
+			trace.WithAttributes(attribute.String("event.type", env.Type)))
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := h.Backplane.Publish(ctx, env); err != nil {
+			slog.Error("failed to publish event", "type", env.Type, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to publish event")
 		}
+		cancel()
+		span.End()
 	}
 }
@@ -0,0 +1,17 @@
+// Package logging configures the structured logger (log/slog) of the server.
+package logging
+
+import (
+	"io"
+	"log/slog"
+)
+
+// New returns a logger writing JSON lines in production and human-readable
+// text otherwise (ENV=development)
+func New(env string, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if env == "production" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestInstrument_PanicCountedAs500(t *testing.T) {
+	m := New()
+	r := mux.NewRouter()
+	r.Use(m.Instrument)
+	r.HandleFunc("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		// panic は外側の Recover に任せるため、Instrument は記録した後に panic し直す
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("Expected the panic to be re-raised, got %v", v)
+			}
+		}()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/boom", nil))
+	}()
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	want := `fuwapachi_http_requests_total{method="GET",route="/boom",status="500"} 1`
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("Expected metrics to contain %q", want)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"fuwapachi/internal/apierror"
+)
+
+// defaultAdminName は ADMIN_TOKEN（名前なしのトークン）の管理者名
+const defaultAdminName = "admin"
+
+type adminContextKey struct{}
+
+// RequireAdmin allows only requests carrying "Authorization: Bearer <token>"
+// for token (named "admin") or one of the tokens in named, a comma-separated
+// list of "name:token" entries. token はそのまま比較するため ":" や "," を含んでもよい。
+// どちらも空の場合は管理APIを無効にし、すべてのリクエストを拒否する
+func RequireAdmin(token, named string) func(http.Handler) http.Handler {
+	tokens := parseAdminTokens(named)
+	if token = strings.TrimSpace(token); token != "" {
+		tokens[token] = defaultAdminName
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(tokens) == 0 {
+				WriteError(w, req, apierror.New(apierror.AdminDisabled))
+				return
+			}
+
+			given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			name := ""
+			if ok {
+				// 一致しなくてもすべてのトークンと比較し、応答時間から推測されないようにする
+				for token, n := range tokens {
+					if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+						name = n
+					}
+				}
+			}
+			if name == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				WriteError(w, req, apierror.New(apierror.Unauthorized))
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), adminContextKey{}, name)))
+		})
+	}
+}
+
+// AdminName returns the name of the admin authenticated by RequireAdmin,
+// or "" for other requests
+func AdminName(r *http.Request) string {
+	name, _ := r.Context().Value(adminContextKey{}).(string)
+	return name
+}
+
+// parseAdminTokens returns the admin names keyed by token for a list of
+// "name:token" entries. 名前のないエントリは無視する
+func parseAdminTokens(named string) map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(named, ",") {
+		name, token, ok := strings.Cut(entry, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			continue
+		}
+		tokens[token] = name
+	}
+	return tokens
+}
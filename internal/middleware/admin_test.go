@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin_Tokens(t *testing.T) {
+	var gotName string
+	handler := RequireAdmin("s3cr:et,x", "alice:token-a, bob:token-b")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName = AdminName(r)
+	}))
+
+	tests := []struct {
+		token    string
+		wantCode int
+		wantName string
+	}{
+		// ADMIN_TOKEN は ":" や "," を含んでも全体が1つのトークン
+		{"s3cr:et,x", http.StatusOK, defaultAdminName},
+		{"et,x", http.StatusUnauthorized, ""},
+		{"s3cr", http.StatusUnauthorized, ""},
+		{"token-a", http.StatusOK, "alice"},
+		{"token-b", http.StatusOK, "bob"},
+		{"alice:token-a", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		gotName = ""
+		req := httptest.NewRequest("GET", "/admin/bans", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode || gotName != tt.wantName {
+			t.Errorf("token %q: expected %d %q, got %d %q", tt.token, tt.wantCode, tt.wantName, rr.Code, gotName)
+		}
+	}
+}
+
+func TestRequireAdmin_Disabled(t *testing.T) {
+	handler := RequireAdmin("", "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/admin/bans", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"fuwapachi/internal/apierror"
+	"fuwapachi/internal/model"
+)
+
+// BanLookup finds the active ban covering an IP address
+type BanLookup interface {
+	Lookup(ip string) (model.Ban, bool)
+}
+
+// RejectBanned rejects requests from banned IP addresses with 403.
+// レート制限より前に適用し、禁止されたクライアントのリクエストでバケットを消費しない
+func RejectBanned(bans BanLookup) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ban, banned := bans.Lookup(ClientIP(req))
+			if !banned {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			var details []any
+			if ban.ExpiresAt != nil {
+				details = []any{"expires_at", ban.ExpiresAt.UTC().Format(time.RFC3339)}
+			}
+			WriteError(w, req, apierror.New(apierror.IPBanned, details...))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientTokenHeader is an optional header identifying an anonymous client
+// across IP address changes
+const ClientTokenHeader = "X-Client-Token"
+
+// ClientIP returns the IP address of the client without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientKey returns a pseudonymous identifier of the client: a hash of
+// X-Client-Token when present, otherwise a hash of the IP address
+func ClientKey(r *http.Request) string {
+	if token := strings.TrimSpace(r.Header.Get(ClientTokenHeader)); token != "" {
+		return hashKey("token:" + token)
+	}
+	return IPKey(r)
+}
+
+// IPKey returns a pseudonymous identifier of the client IP address, ignoring
+// X-Client-Token. トークンは自由に作り直せるため、1人1回に制限したい操作（通報・リアクション）はこちらで数える
+func IPKey(r *http.Request) string {
+	return hashKey("ip:" + ClientIP(r))
+}
+
+func hashKey(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,17 +1,21 @@
 package middleware
 
 import (
-	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"fuwapachi/internal/apierror"
 )
 
 type RateLimiter struct {
 	mu      sync.Mutex
 	clients map[string]*client
+	// rejected は Limit が 429 で拒否したリクエストの数
+	rejected atomic.Uint64
 }
 
 type client struct {
@@ -46,10 +50,7 @@ func (rl *RateLimiter) cleanup() {
 func (rl *RateLimiter) Limit(r rate.Limit, b int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			ip := req.RemoteAddr
-			// if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
-			// 	ip = strings.Split(forwarded, ",")[0]
-			// }
+			ip := rateLimitKey(req)
 
 			rl.mu.Lock()
 			if _, found := rl.clients[ip]; !found {
@@ -60,9 +61,8 @@ func (rl *RateLimiter) Limit(r rate.Limit, b int) func(http.Handler) http.Handle
 			rl.mu.Unlock()
 
 			if !limiter.Allow() {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				json.NewEncoder(w).Encode(map[string]string{"error": "Too many requests"})
+				rl.rejected.Add(1)
+				WriteError(w, req, apierror.New(apierror.RateLimited))
 				return
 			}
 
@@ -70,3 +70,35 @@ func (rl *RateLimiter) Limit(r rate.Limit, b int) func(http.Handler) http.Handle
 		})
 	}
 }
+
+// Rejections returns the number of requests rejected by Limit so far
+func (rl *RateLimiter) Rejections() uint64 {
+	return rl.rejected.Load()
+}
+
+// Pressure returns how much of the client's burst is used up, from 0 (full
+// bucket or unknown client) to 1 (requests are being rejected)
+func (rl *RateLimiter) Pressure(req *http.Request) float64 {
+	rl.mu.Lock()
+	c, found := rl.clients[rateLimitKey(req)]
+	rl.mu.Unlock()
+	if !found {
+		return 0
+	}
+
+	burst := c.limiter.Burst()
+	if burst <= 0 {
+		return 1
+	}
+	tokens := c.limiter.Tokens()
+	if tokens <= 0 {
+		return 1
+	}
+	return 1 - tokens/float64(burst)
+}
+
+// rateLimitKey identifies the client of req for rate limiting.
+// ポートを含めると接続ごとに新しいバケットになり制限（と Pressure）を回避できるため、IPアドレスで数える
+func rateLimitKey(req *http.Request) string {
+	return ClientIP(req)
+}
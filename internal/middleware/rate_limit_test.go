@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fuwapachi/internal/apierror"
+)
+
+func TestRateLimiter_LocalizedError(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.Limit(0, 1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		acceptLanguage string
+		wantLanguage   string
+		wantMessage    string
+	}{
+		{"ja-JP,ja;q=0.9", "ja", "リクエストが多すぎます。しばらくしてから再度お試しください"},
+		{"en-US", "en", "Too many requests"},
+		{"", "en", "Too many requests"},
+	}
+
+	// バースト（1）を使い切る
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/messages", nil))
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/messages", nil)
+		req.Header.Set("Accept-Language", tt.acceptLanguage)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Language"); got != tt.wantLanguage {
+			t.Errorf("Expected Content-Language %q, got %q", tt.wantLanguage, got)
+		}
+
+		var body apierror.Body
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.Code != apierror.RateLimited || body.Message != tt.wantMessage || body.Error != tt.wantMessage {
+			t.Errorf("Unexpected error body for %q: %+v", tt.acceptLanguage, body)
+		}
+	}
+}
+
+func TestRateLimiter_KeyedByIP(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.Limit(0, 2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	newRequest := func(remoteAddr string) *http.Request {
+		req := httptest.NewRequest("POST", "/messages", nil)
+		req.RemoteAddr = remoteAddr
+		return req
+	}
+
+	// 同じIPアドレスからの別の接続（ポート）は同じバケットを使う
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("192.0.2.30:1111"))
+	if p := rl.Pressure(newRequest("192.0.2.30:2222")); p != 0.5 {
+		t.Errorf("Expected pressure 0.5 on a new connection, got %v", p)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("192.0.2.30:2222"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest("192.0.2.30:3333"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	if p := rl.Pressure(newRequest("192.0.2.31:1111")); p != 0 {
+		t.Errorf("Expected pressure 0 for another IP address, got %v", p)
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"fuwapachi/internal/apierror"
+)
+
+// Recover turns a panic in next into a 500 JSON response, logging the panic
+// and its stack with the request ID instead of dropping the connection.
+// レスポンスの送信を始めた後や WebSocket へのアップグレード後の panic は、
+// 壊れたレスポンスを続けて書かないよう http.ErrAbortHandler で接続を中断する。
+// RequestID の内側に置くこと（ログとレスポンスにリクエストIDを含めるため）
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// http.ErrAbortHandler はレスポンスを中断するための意図的な panic
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			Logger(req).Error("panic recovered", "panic", v, "stack", string(debug.Stack()))
+			if rw.started {
+				panic(http.ErrAbortHandler)
+			}
+			WriteError(w, req, apierror.New(apierror.InternalError))
+		}()
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// recoverWriter records whether the response has been started or the
+// connection hijacked, after which Recover can no longer write an error
+type recoverWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (rw *recoverWriter) WriteHeader(status int) {
+	rw.started = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recoverWriter) Write(b []byte) (int, error) {
+	rw.started = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket upgrades pass through the writer
+func (rw *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	rw.started = true
+	return hijacker.Hijack()
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"fuwapachi/internal/apierror"
+)
+
+// RequestIDHeader carries the ID of a request, accepted from the client (or
+// a proxy in front of the server) and generated otherwise
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength は受け付ける X-Request-ID の最大長
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+type loggerContextKey struct{}
+
+// RequestID assigns an ID to every request, echoes it in the X-Request-ID
+// response header and attaches a logger carrying it to the request context
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := slog.Default().With(
+			"request_id", id,
+			"method", req.Method,
+			"path", req.URL.Path,
+		)
+		ctx := context.WithValue(req.Context(), requestIDContextKey{}, id)
+		ctx = context.WithValue(ctx, loggerContextKey{}, logger)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the ID assigned by RequestID, or "" outside of it
+func RequestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// Logger returns the logger of r, carrying the request ID, method and path.
+// RequestID の外（テストなど）では method と path のみを付けたロガーを返す
+func Logger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default().With("method", r.Method, "path", r.URL.Path)
+}
+
+// WriteError writes the JSON error response for e, with the message in the
+// language negotiated from Accept-Language. The request ID is added as
+// "request_id" so that clients can report it
+func WriteError(w http.ResponseWriter, r *http.Request, e *apierror.Error) {
+	lang := apierror.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", lang.String())
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(e.Body(RequestIDFrom(r), lang))
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so that a
+// client-supplied ID cannot break log lines or response headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
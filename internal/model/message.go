@@ -8,6 +8,42 @@ type Message struct {
 	Content   string     `json:"content"`
 	CreatedAt time.Time  `json:"created_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ParentID は返信先メッセージのID（返信でない場合は nil）
+	ParentID *string `json:"parent_id,omitempty"`
+	// Reactions はリアクション種別ごとの件数（GET /messages のみ）
+	Reactions map[string]int `json:"reactions,omitempty"`
+	// HeldReason は作成時に保留された理由（POST /messages と管理APIのレスポンスのみ）
+	HeldReason *string `json:"held_reason,omitempty"`
+	// Status はモデレーションの状態（POST /messages と管理APIのレスポンスのみ）
+	Status string `json:"status,omitempty"`
+}
+
+// Moderation statuses of a message
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	// StatusShadowed はシャドウバンされたクライアントの投稿（投稿者本人にのみ表示される）
+	StatusShadowed = "shadowed"
+)
+
+// MessagePage is the response of GET /messages?order=...
+type MessagePage struct {
+	Messages []Message `json:"messages"`
+	// NextCursor は次のページを取得するための cursor（最後のページでは空）
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Thread is the response of GET /messages/{id}/thread
+type Thread struct {
+	Parent  Message   `json:"parent"`
+	Replies []Message `json:"replies"`
+}
+
+// Event is a notification pushed to WebSocket clients.
+// Implementations are encoded as JSON and sent to clients as-is.
+type Event interface {
+	EventType() string
 }
 
 // DeleteEventMessage is used for WebSocket delete notifications
@@ -16,3 +52,165 @@ type DeleteEventMessage struct {
 	ID        string    `json:"id"`
 	DeletedAt time.Time `json:"deleted_at"`
 }
+
+// EventType implements Event
+func (e DeleteEventMessage) EventType() string { return e.Type }
+
+// PresenceEventMessage is used for WebSocket online count notifications
+type PresenceEventMessage struct {
+	Type   string `json:"type"`
+	Online int    `json:"online"`
+}
+
+// EventType implements Event
+func (e PresenceEventMessage) EventType() string { return e.Type }
+
+// PresenceCountEvent is published through the backplane so that every
+// instance can sum the online counts of all instances.
+// HandleBroadcast が受け取って集計し、クライアントには送信しない
+type PresenceCountEvent struct {
+	Type     string `json:"type"`
+	Instance string `json:"instance"`
+	Online   int    `json:"online"`
+}
+
+// EventType implements Event
+func (e PresenceCountEvent) EventType() string { return e.Type }
+
+// OnlineStats is the response of GET /stats/online
+type OnlineStats struct {
+	Online int `json:"online"`
+}
+
+// ReactionKinds is the set of reactions accepted by POST /messages/{id}/reactions
+var ReactionKinds = map[string]bool{
+	"pachi":    true,
+	"heart":    true,
+	"laugh":    true,
+	"surprise": true,
+	"cry":      true,
+}
+
+// ReactionRequest is the request body of POST /messages/{id}/reactions
+type ReactionRequest struct {
+	Kind string `json:"kind"`
+}
+
+// ReactionEventMessage is used for WebSocket reaction count notifications
+// and as the response of POST /messages/{id}/reactions
+type ReactionEventMessage struct {
+	Type      string         `json:"type"`
+	ID        string         `json:"id"`
+	Reactions map[string]int `json:"reactions"`
+}
+
+// EventType implements Event
+func (e ReactionEventMessage) EventType() string { return e.Type }
+
+// ReportReasons is the set of reasons accepted by POST /messages/{id}/reports
+var ReportReasons = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"inappropriate": true,
+	"personal_info": true,
+	"other":         true,
+}
+
+// ReportRequest is the request body of POST /messages/{id}/reports
+type ReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Report is the response of POST /messages/{id}/reports
+type Report struct {
+	MessageID string    `json:"message_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HiddenEventMessage is used for WebSocket notifications of messages hidden by reports
+type HiddenEventMessage struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id"`
+	HiddenAt time.Time `json:"hidden_at"`
+}
+
+// EventType implements Event
+func (e HiddenEventMessage) EventType() string { return e.Type }
+
+// CreateEventMessage is used for WebSocket notifications of messages
+// published by moderator approval
+type CreateEventMessage struct {
+	Type string `json:"type"`
+	Message
+}
+
+// EventType implements Event
+func (e CreateEventMessage) EventType() string { return e.Type }
+
+// ModerationRequest is the optional request body of the admin moderation endpoints
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AuditEvent is an entry of the audit log
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// ActorType は操作した主体の種類（ip / token / admin / system）
+	ActorType string `json:"actor_type"`
+	// ActorID は IP アドレス、トークンのハッシュ、または管理者名
+	ActorID  string  `json:"actor_id"`
+	ActorIP  string  `json:"actor_ip,omitempty"`
+	Action   string  `json:"action"`
+	TargetID *string `json:"target_id,omitempty"`
+	Reason   *string `json:"reason,omitempty"`
+}
+
+// AuditPage is the response of GET /admin/audit
+type AuditPage struct {
+	Events []AuditEvent `json:"events"`
+	// NextCursor は次のページを取得するための cursor（最後のページでは空）
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Ban is an entry of the IP/CIDR ban list
+type Ban struct {
+	ID string `json:"id"`
+	// CIDR は禁止するアドレス範囲（単一のIPは /32 または /128）
+	CIDR      string     `json:"cidr"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// BanRequest is the request body of POST /admin/bans
+type BanRequest struct {
+	// CIDR は IP アドレスまたは CIDR 表記のアドレス範囲
+	CIDR   string `json:"cidr"`
+	Reason string `json:"reason"`
+	// Duration は禁止する期間（例: "24h"）。ExpiresAt とどちらも省略した場合は無期限
+	Duration  string     `json:"duration"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ShadowBan is an entry of the shadow-ban list. 対象のクライアントの投稿は
+// 本人にだけ表示され、他のクライアントには一覧にもブロードキャストにも現れない
+type ShadowBan struct {
+	// ActorType は ip または token、ActorID は IP アドレスまたはトークンのハッシュ
+	// （監査ログの actor_type / actor_id と同じ値）
+	ActorType string    `json:"actor_type"`
+	ActorID   string    `json:"actor_id"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShadowBanRequest is the request body of POST /admin/shadow-bans
+type ShadowBanRequest struct {
+	// ActorType は ip または token、ActorID は IP アドレスまたは X-Client-Token の SHA-256
+	ActorType string `json:"actor_type"`
+	ActorID   string `json:"actor_id"`
+	Reason    string `json:"reason"`
+}
@@ -0,0 +1,261 @@
+// Package ngword filters message content against a word list file.
+//
+// The list has one rule per line: a word optionally followed by an action
+// (reject, mask or hold; reject when omitted). Lines starting with # are
+// comments. Words and content are compared after textnorm.Fold, so
+// full/half-width, case, spacing and hiragana/katakana differences are ignored.
+package ngword
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"fuwapachi/internal/textnorm"
+)
+
+// Action is what to do with content matching a rule
+type Action string
+
+const (
+	// ActionNone means no rule matched
+	ActionNone Action = ""
+	// ActionMask replaces the matched characters with maskRune
+	ActionMask Action = "mask"
+	// ActionHold stores the message without publishing it
+	ActionHold Action = "hold"
+	// ActionReject refuses the message
+	ActionReject Action = "reject"
+)
+
+// maskRune は mask で置き換える文字
+const maskRune = '*'
+
+// severity は複数のルールに一致した場合の優先順位
+var severity = map[Action]int{
+	ActionNone:   0,
+	ActionMask:   1,
+	ActionHold:   2,
+	ActionReject: 3,
+}
+
+// Rule is a single entry of the word list
+type Rule struct {
+	// Word は textnorm.Fold で正規化済みの単語
+	Word   []rune
+	Action Action
+}
+
+// Result is the outcome of Filter.Check
+type Result struct {
+	// Action は一致したルールのうち最も重いアクション
+	Action Action
+	// Content は mask ルールに一致した部分を伏せた内容
+	Content string
+}
+
+// Filter holds the rules loaded from a word list file
+type Filter struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []Rule
+	modTime time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a Filter for the word list at path. Rules are loaded by Reload;
+// an empty path yields a Filter that never matches.
+func New(path string) *Filter {
+	return &Filter{
+		path: path,
+		done: make(chan struct{}),
+	}
+}
+
+// Parse reads rules from a word list
+func Parse(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// 最後のフィールドがアクション名の場合のみアクションとして扱い、
+		// それ以外は行全体を（空白を含む）単語とする
+		fields := strings.Fields(text)
+		action := ActionReject
+		if len(fields) > 1 {
+			switch last := Action(strings.ToLower(fields[len(fields)-1])); last {
+			case ActionMask, ActionHold, ActionReject:
+				action = last
+				fields = fields[:len(fields)-1]
+			}
+		}
+
+		word, _ := textnorm.Fold(strings.Join(fields, " "))
+		if len(word) == 0 {
+			return nil, fmt.Errorf("line %d: word is empty after normalization", line)
+		}
+		rules = append(rules, Rule{Word: word, Action: action})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Reload reads the word list again if it has been modified since the last load.
+// 読み込みに失敗した場合は以前のルールを使い続ける
+func (f *Filter) Reload() error {
+	if f.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat word list: %w", err)
+	}
+
+	f.mu.RLock()
+	unchanged := info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to open word list: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse word list %s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.rules = rules
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	slog.Info("loaded NG word rules", "count", len(rules), "path", f.path)
+	return nil
+}
+
+// Watch reloads the word list every interval until Close is called
+func (f *Filter) Watch(interval time.Duration) {
+	if f.path == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := f.Reload(); err != nil {
+			slog.Error("failed to reload NG word list", "error", err)
+		}
+	}
+}
+
+// Close stops Watch
+func (f *Filter) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
+
+// Check matches content against the rules
+func (f *Filter) Check(content string) Result {
+	result := Result{Action: ActionNone, Content: content}
+
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+	if len(rules) == 0 {
+		return result
+	}
+
+	folded, spans := textnorm.Fold(content)
+
+	// 伏せる範囲を元の文字列での開始位置で引けるようにする
+	masked := make(map[int]textnorm.Span)
+	for _, rule := range rules {
+		for _, start := range indexAll(folded, rule.Word) {
+			if severity[rule.Action] > severity[result.Action] {
+				result.Action = rule.Action
+			}
+			if rule.Action != ActionMask {
+				continue
+			}
+			for _, span := range spans[start : start+len(rule.Word)] {
+				masked[span.Start] = span
+			}
+		}
+	}
+
+	if len(masked) > 0 {
+		result.Content = mask(content, masked)
+	}
+	return result
+}
+
+// indexAll returns the start index of every occurrence of word in s
+func indexAll(s, word []rune) []int {
+	var found []int
+	for i := 0; i+len(word) <= len(s); i++ {
+		match := true
+		for j, r := range word {
+			if s[i+j] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// mask replaces every rune inside the given spans of content with maskRune
+func mask(content string, spans map[int]textnorm.Span) string {
+	var b strings.Builder
+	b.Grow(len(content))
+	for i := 0; i < len(content); {
+		span, ok := spans[i]
+		if !ok {
+			_, size := utf8.DecodeRuneInString(content[i:])
+			b.WriteString(content[i : i+size])
+			i += size
+			continue
+		}
+		// 伏せた後も文字数が変わらないよう、元のルーン数分の maskRune に置き換える
+		for range content[span.Start:span.End] {
+			b.WriteRune(maskRune)
+		}
+		i = span.End
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package ngword
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fuwapachi/internal/textnorm"
+)
+
+const testList = `# テスト用の NG ワード
+ばか mask
+spam hold
+死ね
+`
+
+func newTestFilter(t *testing.T, list string) *Filter {
+	path := filepath.Join(t.TempDir(), "ngwords.txt")
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatalf("Failed to write word list: %v", err)
+	}
+
+	f := New(path)
+	if err := f.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	return f
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(strings.NewReader(testList))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+	if rules[2].Action != ActionReject {
+		t.Errorf("Expected default action reject, got %q", rules[2].Action)
+	}
+
+	// 最後のフィールドがアクション名でなければ、行全体を単語として扱う
+	rules, err = Parse(strings.NewReader("bad word\nbuy now hold\n"))
+	if err != nil {
+		t.Fatalf("Parse failed for phrases: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if want, _ := textnorm.Fold("bad word"); string(rules[0].Word) != string(want) || rules[0].Action != ActionReject {
+		t.Errorf("Expected phrase %q with action reject, got %q %s", string(want), string(rules[0].Word), rules[0].Action)
+	}
+	if want, _ := textnorm.Fold("buy now"); string(rules[1].Word) != string(want) || rules[1].Action != ActionHold {
+		t.Errorf("Expected phrase %q with action hold, got %q %s", string(want), string(rules[1].Word), rules[1].Action)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f := newTestFilter(t, testList)
+
+	tests := []struct {
+		content string
+		action  Action
+		masked  string
+	}{
+		{"こんにちは", ActionNone, "こんにちは"},
+		{"バカじゃないの", ActionMask, "**じゃないの"},
+		{"ﾊﾞｶ!", ActionMask, "***!"},
+		{"ば か", ActionMask, "* *"},
+		{"ＳＰＡＭです", ActionHold, "ＳＰＡＭです"},
+		{"しね", ActionNone, "しね"},
+		{"バカ、シネ", ActionMask, "**、シネ"},
+		{"ばか死ね", ActionReject, "**死ね"},
+	}
+
+	for _, tt := range tests {
+		result := f.Check(tt.content)
+		if result.Action != tt.action {
+			t.Errorf("Check(%q).Action = %q, want %q", tt.content, result.Action, tt.action)
+		}
+		if result.Content != tt.masked {
+			t.Errorf("Check(%q).Content = %q, want %q", tt.content, result.Content, tt.masked)
+		}
+	}
+}
+
+func TestReload_PicksUpChanges(t *testing.T) {
+	f := newTestFilter(t, "foo\n")
+	if f.Check("bar").Action != ActionNone {
+		t.Fatal("bar should not match before reload")
+	}
+
+	if err := os.WriteFile(f.path, []byte("bar\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write word list: %v", err)
+	}
+	// 更新日時の解像度が粗いファイルシステムでも変更を検知させる
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(f.path, future, future)
+
+	if err := f.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if f.Check("bar").Action != ActionReject {
+		t.Error("bar should match after reload")
+	}
+
+	// 壊れたリストでは以前のルールを使い続ける
+	// （記号だけの単語は正規化すると空になる）
+	os.WriteFile(f.path, []byte("!!! mask\n"), 0o644)
+	later := future.Add(time.Minute)
+	os.Chtimes(f.path, later, later)
+	if err := f.Reload(); err == nil {
+		t.Error("Expected error for invalid word list")
+	}
+	if f.Check("bar").Action != ActionReject {
+		t.Error("Previous rules should be kept after a failed reload")
+	}
+}
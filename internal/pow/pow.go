@@ -0,0 +1,164 @@
+// Package pow issues and verifies hashcash-style proof-of-work challenges.
+//
+// A challenge is a token signed with HMAC-SHA256 that carries a random nonce,
+// the required difficulty, the expiry and the client it was issued to. The
+// client solves it by finding a string such that
+// SHA-256(token + ":" + solution) starts with at least difficulty zero bits.
+// Verify does not remember solved challenges; callers record the token until
+// the returned expiry so that each challenge can be used only once.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxDifficulty is the upper bound of the difficulty of a challenge
+const MaxDifficulty = 32
+
+// Errors returned by Verify
+var (
+	ErrInvalidToken    = errors.New("invalid challenge token")
+	ErrExpired         = errors.New("challenge has expired")
+	ErrClientMismatch  = errors.New("challenge was issued to another client")
+	ErrInvalidSolution = errors.New("invalid challenge solution")
+)
+
+// Challenge is a puzzle issued to a client
+type Challenge struct {
+	Token      string    `json:"token"`
+	Difficulty int       `json:"difficulty"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Issuer issues and verifies challenges signed with a secret
+type Issuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewIssuer creates an Issuer whose challenges expire after ttl
+func NewIssuer(secret []byte, ttl time.Duration) *Issuer {
+	return &Issuer{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// Issue creates a challenge of the given difficulty for clientKey
+func (i *Issuer) Issue(clientKey string, difficulty int) (Challenge, error) {
+	if difficulty < 0 {
+		difficulty = 0
+	}
+	if difficulty > MaxDifficulty {
+		difficulty = MaxDifficulty
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	expiresAt := time.Now().Add(i.ttl).Truncate(time.Second)
+	payload := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString(nonce),
+		strconv.Itoa(difficulty),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		clientKey,
+	}, "|")
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(i.sign(payload))
+
+	return Challenge{
+		Token:      token,
+		Difficulty: difficulty,
+		Algorithm:  "sha256",
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify checks that solution solves token for clientKey and returns when
+// the challenge expires
+func (i *Issuer) Verify(token, solution, clientKey string) (time.Time, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, ErrInvalidToken
+	}
+	rawPayload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	payload := string(rawPayload)
+	if !hmac.Equal(sig, i.sign(payload)) {
+		return time.Time{}, ErrInvalidToken
+	}
+
+	parts := strings.Split(payload, "|")
+	if len(parts) != 4 {
+		return time.Time{}, ErrInvalidToken
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	expiresUnix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+
+	if !time.Now().Before(expiresAt) {
+		return time.Time{}, ErrExpired
+	}
+	if parts[3] != clientKey {
+		return time.Time{}, ErrClientMismatch
+	}
+	if LeadingZeroBits(token, solution) < difficulty {
+		return time.Time{}, ErrInvalidSolution
+	}
+	return expiresAt, nil
+}
+
+// LeadingZeroBits returns the number of leading zero bits of
+// SHA-256(token + ":" + solution)
+func LeadingZeroBits(token, solution string) int {
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Solve finds a solution of token by brute force. クライアントの実装例とテスト用
+func Solve(token string, difficulty int) string {
+	for n := 0; ; n++ {
+		solution := strconv.Itoa(n)
+		if LeadingZeroBits(token, solution) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func (i *Issuer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,67 @@
+package pow
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	i := NewIssuer([]byte("secret"), time.Minute)
+
+	c, err := i.Issue("client-a", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	solution := Solve(c.Token, c.Difficulty)
+
+	if _, err := i.Verify(c.Token, solution, "client-b"); err != ErrClientMismatch {
+		t.Errorf("Expected ErrClientMismatch, got %v", err)
+	}
+	expiresAt, err := i.Verify(c.Token, solution, "client-a")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !expiresAt.Equal(c.ExpiresAt) {
+		t.Errorf("Expected expiry %v, got %v", c.ExpiresAt, expiresAt)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	i := NewIssuer([]byte("secret"), time.Minute)
+
+	c, err := i.Issue("client", 16)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	// 解の条件を満たさない文字列を探す
+	wrong := "x"
+	for LeadingZeroBits(c.Token, wrong) >= c.Difficulty {
+		wrong += "x"
+	}
+	if _, err := i.Verify(c.Token, wrong, "client"); err != ErrInvalidSolution {
+		t.Errorf("Expected ErrInvalidSolution, got %v", err)
+	}
+
+	// 別の秘密鍵で署名されたトークンや、難易度を書き換えたトークンは受け付けない
+	other := NewIssuer([]byte("other"), time.Minute)
+	forged, _ := other.Issue("client", 0)
+	if _, err := i.Verify(forged.Token, "0", "client"); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+	payload, sig, _ := strings.Cut(c.Token, ".")
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered := strings.Replace(string(raw), "|16|", "|0|", 1)
+	token := base64.RawURLEncoding.EncodeToString([]byte(tampered)) + "." + sig
+	if _, err := i.Verify(token, "0", "client"); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for a tampered token, got %v", err)
+	}
+
+	expired := NewIssuer([]byte("secret"), -time.Second)
+	old, _ := expired.Issue("client", 0)
+	if _, err := expired.Verify(old.Token, "0", "client"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Package textnorm normalizes message text so that visually equivalent
+// variants (full/half-width, case, spacing, punctuation) compare equal.
+package textnorm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Span is a byte range [Start, End) of the original text
+type Span struct {
+	Start, End int
+}
+
+// Normalize applies NFKC (full-width ASCII to half-width, half-width katakana
+// to full-width with voiced marks composed), lowercases, and removes
+// whitespace, punctuation and symbols
+func Normalize(s string) string {
+	s = norm.NFKC.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if ignored(r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Fold normalizes s like Normalize and additionally folds katakana to
+// hiragana, for matching words regardless of the script they are written in.
+// 結果の各ルーンが元の文字列のどの範囲から生成されたかも返す
+func Fold(s string) ([]rune, []Span) {
+	var folded []rune
+	var spans []Span
+
+	// NFKC は正規化の境界ごとに独立して適用できるため、境界単位で元の位置を記録する
+	for start := 0; start < len(s); {
+		end := start + norm.NFKC.NextBoundaryInString(s[start:], true)
+		for _, r := range norm.NFKC.String(s[start:end]) {
+			if ignored(r) {
+				continue
+			}
+			folded = append(folded, foldKana(unicode.ToLower(r)))
+			spans = append(spans, Span{Start: start, End: end})
+		}
+		start = end
+	}
+	return folded, spans
+}
+
+func ignored(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsControl(r)
+}
+
+// foldKana maps katakana (ァ..ヶ, ヽ, ヾ) to the corresponding hiragana
+func foldKana(r rune) rune {
+	if (r >= 'ァ' && r <= 'ヶ') || r == 'ヽ' || r == 'ヾ' {
+		return r - 0x60
+	}
+	return r
+}
+
+// Fingerprint returns a hash of the normalized text with repeated characters
+// collapsed, so that "すごーーい!!" and "すごーい" share a fingerprint
+func Fingerprint(s string) string {
+	normalized := Normalize(s)
+	if normalized == "" {
+		// 記号だけのメッセージは元の文字列で比較する
+		normalized = s
+	}
+
+	var b strings.Builder
+	b.Grow(len(normalized))
+	var prev rune = -1
+	for _, r := range normalized {
+		if r != prev {
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package textnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Ｈｅｌｌｏ　Ｗｏｒｌｄ！", "helloworld"},
+		{"ｶﾞｷﾞｸﾞ", "ガギグ"},
+		{"ふわ・ぱち!!", "ふわぱち"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint_NearIdentical(t *testing.T) {
+	base := Fingerprint("すごーい")
+
+	for _, variant := range []string{"すごーーーい!!", "す ご ー い", "すごーい。"} {
+		if Fingerprint(variant) != base {
+			t.Errorf("Fingerprint(%q) should match Fingerprint(%q)", variant, "すごーい")
+		}
+	}
+
+	if Fingerprint("すごい") == base {
+		t.Error("Different text should not share a fingerprint")
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"バカ", "ばか"},
+		{"ﾊﾞｶ", "ばか"},
+		{"ば か！", "ばか"},
+		{"ＳＰＡＭ", "spam"},
+	}
+
+	for _, tt := range tests {
+		got, _ := Fold(tt.in)
+		if string(got) != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.in, string(got), tt.want)
+		}
+	}
+}
+
+func TestFold_Spans(t *testing.T) {
+	in := "aﾊﾞ b"
+	folded, spans := Fold(in)
+
+	if string(folded) != "aばb" || len(spans) != len(folded) {
+		t.Fatalf("Fold(%q) = %q with %d spans", in, string(folded), len(spans))
+	}
+	// ﾊﾞ（2ルーン）は1つの「ば」になり、元の2ルーン分の範囲を指す
+	want := []string{"a", "ﾊﾞ", "b"}
+	for i, span := range spans {
+		if got := in[span.Start:span.End]; got != want[i] {
+			t.Errorf("span %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"fuwapachi/internal/config"
+)
+
+func TestSetup_StdoutFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	shutdown, err := Setup(context.Background(), config.Config{
+		Env:                "development",
+		TracingExporter:    ExporterStdout,
+		TracingFile:        path,
+		TracingSampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	_, span := Tracer().Start(context.Background(), "test.span")
+	span.End()
+
+	// Shutdown でバッチが書き出される
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"test.span"`) {
+		t.Errorf("Expected the span in the trace file, got %s", data)
+	}
+	if !strings.Contains(string(data), ServiceName) {
+		t.Errorf("Expected service.name %q in the trace file", ServiceName)
+	}
+}
+
+func TestSetup_Exporters(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Config{TracingExporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Setup failed for none: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown failed for none: %v", err)
+	}
+
+	if _, err := Setup(context.Background(), config.Config{TracingExporter: "zipkin"}); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}